@@ -0,0 +1,222 @@
+// Package skim is a speed reader for the terminal. It shows text one word at
+// a time with the Optimal Recognition Point highlighted.
+//
+// Run reads a text in a full-screen reader of its own. NewSession returns the
+// same reader as a Bubble Tea model, for programs with a TUI of their own.
+// Main is the skim command itself.
+package skim
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/rivo/uniseg"
+)
+
+// Options configures a reading session. Empty fields take the skim
+// command's defaults, and settings not here, such as key bindings, are the
+// command's defaults too.
+type Options struct {
+	WPM            int    // reading speed in words per minute; 500 if zero
+	MaxWPM         int    // fastest speed the keys can reach; 1500 if zero
+	Adaptive       bool   // give longer words more time
+	EaseSentences  bool   // slow down over the last words of each sentence
+	Warmup         bool   // ramp up to WPM over the first words
+	RewindOnResume int    // words to go back when playback resumes
+	Jump           int    // words to move with [ and ]; 10 if zero
+	StopAt         string // pause after each "sentence" or "paragraph", or "never"
+	OnFinish       string // after the last word: "pause", "quit" or "loop"
+	Bell           bool   // ring the terminal bell after the last word
+
+	Markdown    bool   // strip markdown syntax from the text
+	ReadCode    bool   // read code blocks instead of folding each into one word
+	KeepRefs    bool   // keep citation markers and long URLs in web pages
+	KeepEscapes bool   // keep terminal escape sequences in the text
+	Lang        string // tokenization: "auto", "cjk" or "latin"
+	URLs        string // how URLs are read: "keep", "strip" or "placeholder"
+	LongWords   string // words too long for the screen: "split" or "truncate"
+
+	Theme     string // a -theme preset
+	Context   string // context around the focus word: "wide", "narrow" or "off"
+	Guide     string // focus guide marks: "above", "both" or "off"
+	GuideChar string // character drawn as the focus guide
+
+	// Cache fetches URLs opened in the session through skim's page cache,
+	// and State keeps recent files, marks and reading list progress in
+	// skim's state directory, as the skim command does. Without them the
+	// session reads and writes none of the user's files.
+	Cache bool
+	State bool
+
+	// Keyboard input and screen output for Run. They default to the
+	// terminal on stdin and stdout.
+	Input  io.Reader
+	Output io.Writer
+}
+
+// configure checks the options and applies them to m and to the package's
+// text handling. Text is tokenized with package-wide settings, so sessions
+// with different text options shouldn't load at the same time.
+func (o Options) configure(m *model) error {
+	d := defaultConfig()
+	choices := []struct {
+		name  string
+		value *string
+		def   string
+		valid []string
+	}{
+		{"StopAt", &o.StopAt, d.StopAt, stopModes},
+		{"OnFinish", &o.OnFinish, d.OnFinish, []string{"pause", "quit", "loop"}},
+		{"Lang", &o.Lang, d.Lang, []string{"auto", "cjk", "latin"}},
+		{"URLs", &o.URLs, d.URLs, []string{"keep", "strip", "placeholder"}},
+		{"LongWords", &o.LongWords, d.LongWords, []string{"split", "truncate"}},
+		{"Context", &o.Context, d.Context, contextModes},
+		{"Guide", &o.Guide, d.Guide, guideModes},
+	}
+	for _, c := range choices {
+		*c.value = cmp.Or(*c.value, c.def)
+		if !slices.Contains(c.valid, *c.value) {
+			return fmt.Errorf("invalid %s %q: must be %s", c.name, *c.value, strings.Join(c.valid, ", "))
+		}
+	}
+	o.Theme = cmp.Or(o.Theme, d.Theme)
+	if !isThemeName(o.Theme) {
+		return fmt.Errorf("invalid Theme %q: must be one of %s", o.Theme, strings.Join(themeNames(), ", "))
+	}
+	o.GuideChar = cmp.Or(o.GuideChar, d.GuideChar)
+	if uniseg.StringWidth(o.GuideChar) != 1 {
+		return fmt.Errorf("invalid GuideChar %q: must be a single character one cell wide", o.GuideChar)
+	}
+
+	langMode, urlMode, longWords = o.Lang, o.URLs, o.LongWords
+	rawMarkdown, readCode, keepRefs = false, o.ReadCode, o.KeepRefs
+	stripEscapes = !o.KeepEscapes
+	jsonPath, forceJSON = "", false
+
+	m.maxWPM = max(minWPM, cmp.Or(o.MaxWPM, d.MaxWPM))
+	m.wpm = clampWPM(cmp.Or(o.WPM, d.WPM), m.maxWPM)
+	m.setAdaptive(o.Adaptive)
+	m.easeSentences = o.EaseSentences
+	m.warmup = o.Warmup
+	m.rewindOnResume = max(0, o.RewindOnResume)
+	m.setJumpSize(max(1, cmp.Or(o.Jump, d.Jump)))
+	m.stopAt, m.onFinish, m.bell = o.StopAt, o.OnFinish, o.Bell
+	m.contextMode, m.guideMode, m.guideChar = o.Context, o.Guide, o.GuideChar
+	m.setTheme(lookupTheme(o.Theme))
+	m.cache = o.Cache
+	if o.State {
+		m.restoreState()
+	}
+	return nil
+}
+
+// Session is a reader for one text
+type Session struct {
+	m model
+}
+
+// NewSession starts reading text from r. The first chunk is read straight
+// away, so text that can't be read is reported here. The rest is read while
+// the session runs, and r is not closed.
+func NewSession(r io.Reader, opts Options) (*Session, error) {
+	m := initialModel(document{}, defaultConfig().WPM)
+	m.showPicker = false
+	if err := opts.configure(&m); err != nil {
+		return nil, err
+	}
+	l, err := newTextLoader(r, nil, opts.Markdown)
+	if err != nil {
+		return nil, err
+	}
+	if m.startup, err = m.startLoading(l, ""); err != nil {
+		return nil, err
+	}
+	return &Session{m: m}, nil
+}
+
+// Model returns the session as a Bubble Tea model, to be run or embedded in
+// another program
+func (s *Session) Model() tea.Model {
+	return s.m
+}
+
+// Run reads text from r in a full-screen reader until the user quits
+func Run(r io.Reader, opts Options) error {
+	s, err := NewSession(r, opts)
+	if err != nil {
+		return err
+	}
+	progOpts := []tea.ProgramOption{tea.WithAltScreen()}
+	if opts.Input != nil {
+		progOpts = append(progOpts, tea.WithInput(opts.Input))
+	} else if r == os.Stdin {
+		// The text is on stdin, so keys come from the terminal itself
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			return err
+		}
+		defer tty.Close()
+		progOpts = append(progOpts, tea.WithInput(tty))
+	}
+	if opts.Output != nil {
+		progOpts = append(progOpts, tea.WithOutput(opts.Output))
+	}
+	_, err = tea.NewProgram(s.Model(), progOpts...).Run()
+	return err
+}
+
+// Tokenize splits text into the words the reader shows one at a time.
+// Chinese and Japanese are split a character at a time when there's enough
+// of them.
+func Tokenize(text string) []string {
+	return parseDocument(text).words
+}
+
+// CalculateORP returns the index of the grapheme cluster in word that the
+// eye should fix on
+func CalculateORP(word string) int {
+	return calculateORP(word)
+}
+
+// SanitizeHTML converts an HTML page to markdown text
+func SanitizeHTML(html []byte) string {
+	return sanitizeHTML(html)
+}
+
+// IsURL reports whether s is an absolute URL with a host
+func IsURL(s string) bool {
+	return isURL(s)
+}
+
+// IsBinaryFile reports whether content looks like binary data rather than
+// text, by a NUL byte in its first 8 KB
+func IsBinaryFile(content []byte) bool {
+	return isBinaryFile(content)
+}
+
+// FetchURL fetches a page, transcoded to UTF-8, along with its media type.
+// It is downloaded afresh, without skim's page cache.
+func FetchURL(ctx context.Context, url string) ([]byte, string, error) {
+	return pageContent(fetchUncached(ctx, url))
+}
+
+// FetchCachedURL is FetchURL through skim's page cache, as the skim command
+// fetches: a fresh cached copy is used as is, and a downloaded page is stored
+// in the user's cache directory
+func FetchCachedURL(ctx context.Context, url string) ([]byte, string, error) {
+	return pageContent(fetchPage(ctx, url))
+}
+
+// pageContent returns a fetched page's content and media type
+func pageContent(page cachedPage, err error) ([]byte, string, error) {
+	if err != nil {
+		return nil, "", err
+	}
+	return []byte(page.Content), page.MediaType, nil
+}
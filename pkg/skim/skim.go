@@ -0,0 +1,7948 @@
+package skim
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+	htmltomarkdown "github.com/JohannesKaufmann/html-to-markdown/v2"
+	"github.com/andybalholm/brotli"
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/bubbles/filepicker"
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/fsnotify/fsnotify"
+	"github.com/muesli/termenv"
+	"github.com/rivo/uniseg"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	unicodeenc "golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// Key bindings
+type keyMap struct {
+	PlayPause     key.Binding
+	Prev          key.Binding
+	Next          key.Binding
+	Faster        key.Binding
+	Slower        key.Binding
+	FasterFine    key.Binding
+	SlowerFine    key.Binding
+	JumpBack      key.Binding
+	JumpFwd       key.Binding
+	Seek          key.Binding
+	Goto          key.Binding
+	PrevSentence  key.Binding
+	NextSentence  key.Binding
+	PrevParagraph key.Binding
+	NextParagraph key.Binding
+	Restart       key.Binding
+	Start         key.Binding
+	End           key.Binding
+	Reload        key.Binding
+	OpenFile      key.Binding
+	OpenURL       key.Binding
+	ReadingList   key.Binding
+	Adaptive      key.Binding
+	SetMark       key.Binding
+	JumpMark      key.Binding
+	ShowMarks     key.Binding
+	Sentence      key.Binding
+	CopyWord      key.Binding
+	CopySentence  key.Binding
+	Define        key.Binding
+	FullText      key.Binding
+	Reverse       key.Binding
+	Context       key.Binding
+	Ghost         key.Binding
+	Position      key.Binding
+	StopAt        key.Binding
+	Undo          key.Binding
+	Redo          key.Binding
+	PrevFile      key.Binding
+	NextFile      key.Binding
+	Help          key.Binding
+	Suspend       key.Binding
+	Quit          key.Binding
+}
+
+func (k keyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.PlayPause, k.Prev, k.Next, k.Faster, k.Slower, k.Help}
+}
+
+func (k keyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.PlayPause, k.Prev, k.Next, k.Reverse},
+		{k.Faster, k.Slower, k.Restart, k.Reload},
+		{k.FasterFine, k.SlowerFine},
+		{k.JumpBack, k.JumpFwd, k.Seek, k.Goto},
+		{k.Start, k.End},
+		{k.Undo, k.Redo},
+		{k.PrevSentence, k.NextSentence},
+		{k.PrevParagraph, k.NextParagraph},
+		{k.PrevFile, k.NextFile},
+		{k.SetMark, k.JumpMark, k.ShowMarks},
+		{k.Adaptive, k.StopAt, k.Sentence, k.Context, k.Ghost, k.Position},
+		{k.Define, k.FullText},
+		{k.CopyWord, k.CopySentence},
+		{k.OpenFile, k.OpenURL, k.ReadingList, k.Help},
+		{k.Suspend, k.Quit},
+	}
+}
+
+// Filepicker key bindings
+type fpKeyMap struct {
+	Up     key.Binding
+	Down   key.Binding
+	Open   key.Binding
+	Back   key.Binding
+	Select key.Binding
+	Cancel key.Binding
+}
+
+func (k fpKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Up, k.Down, k.Open, k.Back, k.Select, k.Cancel}
+}
+
+func (k fpKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Up, k.Down, k.Open},
+		{k.Back, k.Select, k.Cancel},
+	}
+}
+
+var fpKeys = fpKeyMap{
+	Up: key.NewBinding(
+		key.WithKeys("up", "k"),
+		key.WithHelp("↑/k", "up"),
+	),
+	Down: key.NewBinding(
+		key.WithKeys("down", "j"),
+		key.WithHelp("↓/j", "down"),
+	),
+	Open: key.NewBinding(
+		key.WithKeys("right", "l"),
+		key.WithHelp("→/l", "open dir"),
+	),
+	Back: key.NewBinding(
+		key.WithKeys("left", "h"),
+		key.WithHelp("←/h", "back"),
+	),
+	Select: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "select"),
+	),
+	Cancel: key.NewBinding(
+		key.WithKeys("esc", "q"),
+		key.WithHelp("esc", "cancel"),
+	),
+}
+
+// Recent files key bindings
+type recentKeyMap struct {
+	Up     key.Binding
+	Down   key.Binding
+	Select key.Binding
+	Browse key.Binding
+	Cancel key.Binding
+}
+
+func (k recentKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Up, k.Down, k.Select, k.Browse, k.Cancel}
+}
+
+func (k recentKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{{k.Up, k.Down, k.Select, k.Browse, k.Cancel}}
+}
+
+var recentKeys = recentKeyMap{
+	Up: key.NewBinding(
+		key.WithKeys("up", "k"),
+		key.WithHelp("↑/k", "up"),
+	),
+	Down: key.NewBinding(
+		key.WithKeys("down", "j"),
+		key.WithHelp("↓/j", "down"),
+	),
+	Select: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "open"),
+	),
+	Browse: key.NewBinding(
+		key.WithKeys("b"),
+		key.WithHelp("b", "browse"),
+	),
+	Cancel: key.NewBinding(
+		key.WithKeys("esc", "q"),
+		key.WithHelp("esc", "cancel"),
+	),
+}
+
+// Feed entry list key bindings
+type feedKeyMap struct {
+	Up       key.Binding
+	Down     key.Binding
+	PageUp   key.Binding
+	PageDown key.Binding
+	Select   key.Binding
+	Cancel   key.Binding
+}
+
+func (k feedKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Up, k.Down, k.PageUp, k.PageDown, k.Select, k.Cancel}
+}
+
+func (k feedKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{{k.Up, k.Down, k.PageUp, k.PageDown, k.Select, k.Cancel}}
+}
+
+var feedKeys = feedKeyMap{
+	Up: key.NewBinding(
+		key.WithKeys("up", "k"),
+		key.WithHelp("↑/k", "up"),
+	),
+	Down: key.NewBinding(
+		key.WithKeys("down", "j"),
+		key.WithHelp("↓/j", "down"),
+	),
+	PageUp: key.NewBinding(
+		key.WithKeys("pgup", "K"),
+		key.WithHelp("pgup/K", "page up"),
+	),
+	PageDown: key.NewBinding(
+		key.WithKeys("pgdown", "J"),
+		key.WithHelp("pgdn/J", "page down"),
+	),
+	Select: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "read"),
+	),
+	Cancel: key.NewBinding(
+		key.WithKeys("esc", "q"),
+		key.WithHelp("esc", "cancel"),
+	),
+}
+
+// Reading list key bindings
+type listKeyMap struct {
+	Up     key.Binding
+	Down   key.Binding
+	Select key.Binding
+	Remove key.Binding
+	Cancel key.Binding
+}
+
+func (k listKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Up, k.Down, k.Select, k.Remove, k.Cancel}
+}
+
+func (k listKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{{k.Up, k.Down, k.Select, k.Remove, k.Cancel}}
+}
+
+var listKeys = listKeyMap{
+	Up: key.NewBinding(
+		key.WithKeys("up", "k"),
+		key.WithHelp("↑/k", "up"),
+	),
+	Down: key.NewBinding(
+		key.WithKeys("down", "j"),
+		key.WithHelp("↓/j", "down"),
+	),
+	Select: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "read"),
+	),
+	Remove: key.NewBinding(
+		key.WithKeys("d"),
+		key.WithHelp("d", "remove"),
+	),
+	Cancel: key.NewBinding(
+		key.WithKeys("esc", "q"),
+		key.WithHelp("esc", "close"),
+	),
+}
+
+// URL input key bindings
+type urlKeyMap struct {
+	Submit   key.Binding
+	OpenFile key.Binding
+	Cancel   key.Binding
+}
+
+func (k urlKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Submit, k.OpenFile, k.Cancel}
+}
+
+func (k urlKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{{k.Submit, k.OpenFile, k.Cancel}}
+}
+
+// Go to prompt key bindings
+type gotoKeyMap struct {
+	Submit key.Binding
+	Cancel key.Binding
+}
+
+func (k gotoKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Submit, k.Cancel}
+}
+
+func (k gotoKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{{k.Submit, k.Cancel}}
+}
+
+var gotoKeys = gotoKeyMap{
+	Submit: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "go"),
+	),
+	Cancel: key.NewBinding(
+		key.WithKeys("esc"),
+		key.WithHelp("esc", "cancel"),
+	),
+}
+
+// Quit confirmation key bindings
+type quitKeyMap struct {
+	Confirm key.Binding
+	Cancel  key.Binding
+}
+
+func (k quitKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Confirm, k.Cancel}
+}
+
+func (k quitKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{{k.Confirm, k.Cancel}}
+}
+
+var quitKeys = quitKeyMap{
+	Confirm: key.NewBinding(
+		key.WithKeys("y", "Y"),
+		key.WithHelp("y", "quit"),
+	),
+	Cancel: key.NewBinding(
+		key.WithKeys("n", "N", "esc"),
+		key.WithHelp("n/esc", "keep reading"),
+	),
+}
+
+// Full text view key bindings, besides the viewport's own for scrolling
+type textKeyMap struct {
+	Scroll key.Binding
+	Read   key.Binding
+	Back   key.Binding
+}
+
+func (k textKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Scroll, k.Read, k.Back}
+}
+
+func (k textKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{{k.Scroll, k.Read, k.Back}}
+}
+
+var textKeys = textKeyMap{
+	Scroll: key.NewBinding(
+		key.WithKeys("up", "down", "pgup", "pgdown"),
+		key.WithHelp("↑/↓/pgup/pgdn", "scroll"),
+	),
+	Read: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "read from top line"),
+	),
+	Back: key.NewBinding(
+		key.WithKeys("esc", "t", "q"),
+		key.WithHelp("esc", "back"),
+	),
+}
+
+var urlKeys = urlKeyMap{
+	Submit: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "fetch"),
+	),
+	OpenFile: key.NewBinding(
+		key.WithKeys("ctrl+o"),
+		key.WithHelp("ctrl+o", "open file"),
+	),
+	Cancel: key.NewBinding(
+		key.WithKeys("esc"),
+		key.WithHelp("esc", "cancel"),
+	),
+}
+
+var keys = keyMap{
+	PlayPause: key.NewBinding(
+		key.WithKeys(" "),
+		key.WithHelp("space", "play/pause"),
+	),
+	Prev: key.NewBinding(
+		key.WithKeys("left", "h"),
+		key.WithHelp("←/h", "prev word"),
+	),
+	Next: key.NewBinding(
+		key.WithKeys("right", "l"),
+		key.WithHelp("→/l", "next word"),
+	),
+	Faster: key.NewBinding(
+		key.WithKeys("up", "k", "+", "="),
+		key.WithHelp("↑/k", "faster"),
+	),
+	Slower: key.NewBinding(
+		key.WithKeys("down", "j", "-", "_"),
+		key.WithHelp("↓/j", "slower"),
+	),
+	FasterFine: key.NewBinding(
+		key.WithKeys("shift+up", "K", ">"),
+		key.WithHelp("K/>", "faster (fine)"),
+	),
+	SlowerFine: key.NewBinding(
+		key.WithKeys("shift+down", "J", "<"),
+		key.WithHelp("J/<", "slower (fine)"),
+	),
+	JumpBack: key.NewBinding(
+		key.WithKeys("["),
+		key.WithHelp("[", "-10 words"),
+	),
+	JumpFwd: key.NewBinding(
+		key.WithKeys("]"),
+		key.WithHelp("]", "+10 words"),
+	),
+	Seek: key.NewBinding(
+		key.WithKeys("%"),
+		key.WithHelp("N%", "seek to N%"),
+	),
+	Goto: key.NewBinding(
+		key.WithKeys(":"),
+		key.WithHelp(":", "go to word or %"),
+	),
+	PrevSentence: key.NewBinding(
+		key.WithKeys("("),
+		key.WithHelp("(", "prev sentence"),
+	),
+	NextSentence: key.NewBinding(
+		key.WithKeys(")"),
+		key.WithHelp(")", "next sentence"),
+	),
+	PrevParagraph: key.NewBinding(
+		key.WithKeys("{"),
+		key.WithHelp("{", "prev paragraph"),
+	),
+	NextParagraph: key.NewBinding(
+		key.WithKeys("}"),
+		key.WithHelp("}", "next paragraph"),
+	),
+	Restart: key.NewBinding(
+		key.WithKeys("r"),
+		key.WithHelp("r", "restart"),
+	),
+	Start: key.NewBinding(
+		key.WithKeys("home"),
+		key.WithHelp("home", "start"),
+	),
+	End: key.NewBinding(
+		key.WithKeys("end"),
+		key.WithHelp("end", "end"),
+	),
+	Reload: key.NewBinding(
+		key.WithKeys("R"),
+		key.WithHelp("R", "reload file"),
+	),
+	OpenFile: key.NewBinding(
+		key.WithKeys("o"),
+		key.WithHelp("o", "open file"),
+	),
+	OpenURL: key.NewBinding(
+		key.WithKeys("O"),
+		key.WithHelp("O", "open url"),
+	),
+	ReadingList: key.NewBinding(
+		key.WithKeys("Q"),
+		key.WithHelp("Q", "reading list"),
+	),
+	Adaptive: key.NewBinding(
+		key.WithKeys("a"),
+		key.WithHelp("a", "adaptive timing"),
+	),
+	SetMark: key.NewBinding(
+		key.WithKeys("m"),
+		key.WithHelp("m", "set mark"),
+	),
+	JumpMark: key.NewBinding(
+		key.WithKeys("'"),
+		key.WithHelp("'", "jump to mark"),
+	),
+	ShowMarks: key.NewBinding(
+		key.WithKeys("M"),
+		key.WithHelp("M", "list marks"),
+	),
+	Sentence: key.NewBinding(
+		key.WithKeys("x"),
+		key.WithHelp("x", "sentence"),
+	),
+	CopyWord: key.NewBinding(
+		key.WithKeys("y"),
+		key.WithHelp("y", "copy word"),
+	),
+	CopySentence: key.NewBinding(
+		key.WithKeys("Y"),
+		key.WithHelp("Y", "copy sentence"),
+	),
+	Define: key.NewBinding(
+		key.WithKeys("d"),
+		key.WithHelp("d", "define word"),
+	),
+	FullText: key.NewBinding(
+		key.WithKeys("t"),
+		key.WithHelp("t", "full text"),
+	),
+	Reverse: key.NewBinding(
+		key.WithKeys("b"),
+		key.WithHelp("b", "reverse"),
+	),
+	Context: key.NewBinding(
+		key.WithKeys("c"),
+		key.WithHelp("c", "context"),
+	),
+	Ghost: key.NewBinding(
+		key.WithKeys("g"),
+		key.WithHelp("g", "ghost words"),
+	),
+	Position: key.NewBinding(
+		key.WithKeys("#"),
+		key.WithHelp("#", "position"),
+	),
+	StopAt: key.NewBinding(
+		key.WithKeys("s"),
+		key.WithHelp("s", "stop at sentences/paragraphs"),
+	),
+	Undo: key.NewBinding(
+		key.WithKeys("u"),
+		key.WithHelp("u", "undo jump"),
+	),
+	Redo: key.NewBinding(
+		key.WithKeys("ctrl+r"),
+		key.WithHelp("ctrl+r", "redo jump"),
+	),
+	PrevFile: key.NewBinding(
+		key.WithKeys("N"),
+		key.WithHelp("N", "prev file"),
+	),
+	NextFile: key.NewBinding(
+		key.WithKeys("n"),
+		key.WithHelp("n", "next file"),
+	),
+	Help: key.NewBinding(
+		key.WithKeys("?"),
+		key.WithHelp("?", "more/less help"),
+	),
+	Suspend: key.NewBinding(
+		key.WithKeys("ctrl+z"),
+		key.WithHelp("ctrl+z", "suspend"),
+	),
+	Quit: key.NewBinding(
+		key.WithKeys("q", "esc", "ctrl+c"),
+		key.WithHelp("q", "quit"),
+	),
+}
+
+// actions maps the action names used in the config's [keys] table to bindings
+func (k *keyMap) actions() map[string]*key.Binding {
+	return map[string]*key.Binding{
+		"play_pause":     &k.PlayPause,
+		"prev":           &k.Prev,
+		"next":           &k.Next,
+		"faster":         &k.Faster,
+		"slower":         &k.Slower,
+		"faster_fine":    &k.FasterFine,
+		"slower_fine":    &k.SlowerFine,
+		"jump_back":      &k.JumpBack,
+		"jump_forward":   &k.JumpFwd,
+		"seek":           &k.Seek,
+		"goto":           &k.Goto,
+		"prev_sentence":  &k.PrevSentence,
+		"next_sentence":  &k.NextSentence,
+		"prev_paragraph": &k.PrevParagraph,
+		"next_paragraph": &k.NextParagraph,
+		"restart":        &k.Restart,
+		"start":          &k.Start,
+		"end":            &k.End,
+		"reload":         &k.Reload,
+		"open_file":      &k.OpenFile,
+		"open_url":       &k.OpenURL,
+		"reading_list":   &k.ReadingList,
+		"adaptive":       &k.Adaptive,
+		"set_mark":       &k.SetMark,
+		"jump_mark":      &k.JumpMark,
+		"show_marks":     &k.ShowMarks,
+		"sentence":       &k.Sentence,
+		"copy_word":      &k.CopyWord,
+		"copy_sentence":  &k.CopySentence,
+		"define":         &k.Define,
+		"full_text":      &k.FullText,
+		"reverse":        &k.Reverse,
+		"context":        &k.Context,
+		"ghost":          &k.Ghost,
+		"position":       &k.Position,
+		"stop_at":        &k.StopAt,
+		"undo":           &k.Undo,
+		"redo":           &k.Redo,
+		"prev_file":      &k.PrevFile,
+		"next_file":      &k.NextFile,
+		"help":           &k.Help,
+		"suspend":        &k.Suspend,
+		"quit":           &k.Quit,
+	}
+}
+
+// keyPresets are curated sets of key overrides chosen with -keys, applied
+// before the config's [keys] table
+var keyPresets = map[string]map[string]keyList{
+	"default": {},
+	"vim": {
+		"prev_sentence": {"b", "("},
+		"next_sentence": {"w", ")"},
+		"jump_back":     {"u", "["},
+		"jump_forward":  {"d", "]"},
+		"start":         {"g", "home"},
+		"end":           {"G", "end"},
+		"faster_fine":   {"shift+up", ">"},
+		"slower_fine":   {"shift+down", "<"},
+		"define":        {"K"},
+		"undo":          {"U"},
+		"reverse":       {"B"},
+		"ghost":         {"z"},
+	},
+}
+
+// doubleKeys must be pressed twice in a row to act, like vim's gg
+var doubleKeys = map[string]bool{}
+
+// applyKeyPreset merges the named preset under the config's overrides
+func applyKeyPreset(name string, overrides map[string]keyList) map[string]keyList {
+	merged := maps.Clone(keyPresets[name])
+	maps.Copy(merged, overrides)
+	return merged
+}
+
+// setDoubleKeys makes g a double key for the vim preset, as long as the
+// remapped keys leave it bound to start and nothing else
+func setDoubleKeys(preset string) {
+	clear(doubleKeys)
+	if preset != "vim" {
+		return
+	}
+	var boundTo []string
+	for name, b := range keys.actions() {
+		if slices.Contains(b.Keys(), "g") {
+			boundTo = append(boundTo, name)
+		}
+	}
+	if slices.Equal(boundTo, []string{"start"}) {
+		doubleKeys["g"] = true
+		keys.Start.SetHelp(keyHelp(keys.Start.Keys()), keys.Start.Help().Desc)
+	}
+}
+
+// Symbols shown in help for keys with long names
+var keySymbols = map[string]string{
+	" ": "space", "left": "←", "right": "→", "up": "↑", "down": "↓",
+}
+
+// keyHelp formats keys for display in help
+func keyHelp(keys []string) string {
+	labels := make([]string, len(keys))
+	for i, k := range keys {
+		labels[i] = k
+		if s, ok := keySymbols[k]; ok {
+			labels[i] = s
+		}
+		if doubleKeys[k] {
+			labels[i] += k
+		}
+	}
+	return strings.Join(labels, "/")
+}
+
+// actions maps the names used for the file picker in the config's [keys]
+// table to bindings
+func (k *fpKeyMap) actions() map[string]*key.Binding {
+	return map[string]*key.Binding{
+		"picker_up":     &k.Up,
+		"picker_down":   &k.Down,
+		"picker_open":   &k.Open,
+		"picker_back":   &k.Back,
+		"picker_select": &k.Select,
+		"picker_cancel": &k.Cancel,
+	}
+}
+
+// pickerKeys drives the file picker itself. Its bindings are the picker's
+// defaults unless fpKeys is remapped.
+var pickerKeys = filepicker.DefaultKeyMap()
+
+// pickerBindings maps file picker action names to the picker's own bindings
+func pickerBindings() map[string]*key.Binding {
+	return map[string]*key.Binding{
+		"picker_up":     &pickerKeys.Up,
+		"picker_down":   &pickerKeys.Down,
+		"picker_open":   &pickerKeys.Open,
+		"picker_back":   &pickerKeys.Back,
+		"picker_select": &pickerKeys.Select,
+	}
+}
+
+// remapKeys applies key overrides by action name to keys and fpKeys. Unknown
+// actions are skipped, and overrides that bind a key to two actions are
+// undone; each is returned as a problem to warn about.
+func remapKeys(overrides map[string]keyList) []string {
+	groups := []map[string]*key.Binding{keys.actions(), fpKeys.actions()}
+	var problems []string
+	defaults := make(map[string]key.Binding) // of the actions remapped
+	for _, name := range slices.Sorted(maps.Keys(overrides)) {
+		ks := overrides[name]
+		i := slices.IndexFunc(groups, func(g map[string]*key.Binding) bool { return g[name] != nil })
+		switch {
+		case i < 0:
+			problems = append(problems, fmt.Sprintf("unknown key action %q", name))
+			continue
+		case len(ks) == 0:
+			problems = append(problems, fmt.Sprintf("no keys given for %q", name))
+			continue
+		}
+		b := groups[i][name]
+		defaults[name] = *b
+		b.SetKeys(ks...)
+		b.SetHelp(keyHelp(ks), b.Help().Desc)
+	}
+
+	for _, g := range groups {
+		for {
+			a, b, k, found := keyConflict(g)
+			if !found {
+				break
+			}
+			problems = append(problems, fmt.Sprintf("key %q is bound to both %s and %s", keyHelp([]string{k}), a, b))
+			reverted := false
+			for _, name := range []string{a, b} {
+				if d, ok := defaults[name]; ok {
+					*g[name] = d
+					delete(defaults, name)
+					reverted = true
+				}
+			}
+			if !reverted {
+				break
+			}
+		}
+	}
+
+	fp := fpKeys.actions()
+	for name, b := range pickerBindings() {
+		if _, ok := defaults[name]; ok {
+			b.SetKeys(fp[name].Keys()...)
+		}
+	}
+	return problems
+}
+
+// keyConflict finds a key bound to two of the given actions
+func keyConflict(actions map[string]*key.Binding) (a, b, k string, found bool) {
+	boundTo := make(map[string]string)
+	for _, name := range slices.Sorted(maps.Keys(actions)) {
+		for _, k := range actions[name].Keys() {
+			if other, ok := boundTo[k]; ok {
+				return other, name, k, true
+			}
+			boundTo[k] = name
+		}
+	}
+	return "", "", "", false
+}
+
+// keyList is one or more keys, written in the config as a string or an array
+type keyList []string
+
+func (l *keyList) UnmarshalTOML(v any) error {
+	switch v := v.(type) {
+	case string:
+		*l = keyList{v}
+	case []any:
+		*l = make(keyList, 0, len(v))
+		for _, k := range v {
+			s, ok := k.(string)
+			if !ok {
+				return fmt.Errorf("keys must be strings, got %v", k)
+			}
+			*l = append(*l, s)
+		}
+	default:
+		return fmt.Errorf("keys must be a string or an array of strings, got %v", v)
+	}
+	return nil
+}
+
+// ORP (Optimal Recognition Point) calculation, as an index into the word's
+// grapheme clusters so emoji and combining sequences are never split
+func calculateORP(word string) int {
+	// CJK units are a single character, possibly followed by punctuation
+	if r, _ := utf8.DecodeRuneInString(word); isCJK(r) {
+		return 0
+	}
+	length := uniseg.GraphemeClusterCount(word)
+	switch {
+	case length <= 1:
+		return 0
+	case length <= 5:
+		return 1
+	case length <= 9:
+		return 2
+	case length <= 13:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// Language mode for tokenization: "auto", "cjk" or "latin"
+var langMode = "auto"
+
+// Fraction of CJK runes above which auto mode segments CJK runs
+const cjkThreshold = 0.2
+
+// CJK punctuation that closes a phrase and stays attached to the preceding character
+const cjkClosingPunct = "、。，．！？：；」』）】〉》〕…"
+
+// isCJK reports whether a rune belongs to a script written without spaces.
+// Hangul is excluded since Korean separates words with spaces.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana) || r == 'ー'
+}
+
+// hasCJK decides whether CJK runs in text should be segmented per character
+func hasCJK(text string) bool {
+	switch langMode {
+	case "cjk":
+		return true
+	case "latin":
+		return false
+	}
+	var cjk, total int
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		total++
+		if isCJK(r) {
+			cjk++
+		}
+	}
+	return total > 0 && float64(cjk)/float64(total) >= cjkThreshold
+}
+
+// splitCJK breaks a whitespace-delimited field into single CJK characters,
+// keeping any embedded Latin text together as one unit
+func splitCJK(field string) []string {
+	var units []string
+	var latin strings.Builder
+	for _, c := range graphemes(field) {
+		r, _ := utf8.DecodeRuneInString(c)
+		switch {
+		case isCJK(r):
+			if latin.Len() > 0 {
+				units = append(units, latin.String())
+				latin.Reset()
+			}
+			units = append(units, c)
+		case strings.ContainsRune(cjkClosingPunct, r) && latin.Len() == 0 && len(units) > 0:
+			units[len(units)-1] += c
+		default:
+			latin.WriteString(c)
+		}
+	}
+	if latin.Len() > 0 {
+		units = append(units, latin.String())
+	}
+	return units
+}
+
+// token is a single word along with the structure that follows it
+type token struct {
+	text            string
+	endsParagraph   bool // followed by a blank line or the end of the text
+	startsParagraph bool // preceded by a blank line after a flushed word
+	heading         bool // part of a heading line
+	code            bool // an inline code span, which may contain spaces
+}
+
+// tokenizer splits text into words incrementally, so text can be fed to it
+// in chunks that break anywhere. The last word seen is held back until it's
+// known whether a blank line follows it.
+type tokenizer struct {
+	segment  bool   // segment CJK runs into characters
+	partial  string // a word cut off at the end of the last chunk
+	held     token
+	holding  bool
+	newlines int  // newlines since the held word
+	heading  bool // inside a line marked as a heading
+	broken   bool // a blank line followed a flushed word
+}
+
+// emit queues a word, releasing the previously held one to out
+func (t *tokenizer) emit(out []token, word string) []token {
+	if t.holding {
+		out = append(out, t.held)
+	}
+	t.held, t.holding, t.newlines = token{text: word, startsParagraph: t.broken, heading: t.heading}, true, 0
+	t.broken = false
+	return out
+}
+
+// feed returns the words completed by the next chunk of text
+func (t *tokenizer) feed(text string) []token {
+	text = t.partial + text
+	t.partial = ""
+	var out []token
+	start := -1
+	for i, r := range text {
+		if !unicode.IsSpace(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			out = t.emitField(out, text[start:i])
+			start = -1
+		}
+		if r == '\n' {
+			t.heading = false
+			t.newlines++
+			if t.newlines == 2 && t.holding {
+				t.held.endsParagraph = true
+			} else if t.newlines == 2 {
+				t.broken = true
+			}
+		}
+	}
+	if start >= 0 {
+		t.partial = strings.Clone(text[start:])
+	}
+	return out
+}
+
+// emitField emits a whitespace-delimited field, segmenting it if needed
+func (t *tokenizer) emitField(out []token, field string) []token {
+	if rest, ok := strings.CutPrefix(field, string(headingMarker)); ok {
+		t.heading = true
+		if field = rest; field == "" {
+			return out
+		}
+	}
+	if strings.ContainsRune(field, codeMarker) {
+		field = strings.Map(func(r rune) rune {
+			switch r {
+			case codeMarker:
+				return -1
+			case codeSpace:
+				return ' '
+			}
+			return r
+		}, field)
+		out = t.emit(out, field)
+		t.held.code = true
+		return out
+	}
+	if urlMode != "keep" {
+		if lead, trail, ok := splitURL(field); ok {
+			if urlMode == "strip" {
+				// Punctuation after the URL still ends the clause before it
+				if t.holding {
+					t.held.text += strings.TrimLeft(trail, ")]}>'\"")
+				}
+				return out
+			}
+			field = lead + linkToken + trail
+		}
+	}
+	if !t.segment {
+		return t.emit(out, field)
+	}
+	for _, w := range splitCJK(field) {
+		out = t.emit(out, w)
+	}
+	return out
+}
+
+// flush releases the held word without waiting to see what follows it, so
+// live text shows every word as soon as it arrives
+func (t *tokenizer) flush() []token {
+	if !t.holding {
+		return nil
+	}
+	t.holding = false
+	return []token{t.held}
+}
+
+// finish returns the remaining words at the end of the text
+func (t *tokenizer) finish() []token {
+	var out []token
+	if t.partial != "" {
+		out = t.emitField(out, t.partial)
+		t.partial = ""
+	}
+	if t.holding {
+		t.held.endsParagraph = true
+		out = append(out, t.held)
+		t.holding = false
+	}
+	return out
+}
+
+// tokenize splits text into words, marking the last word before each blank
+// line as ending a paragraph. CJK runs are segmented when the text contains
+// enough CJK to warrant it.
+func tokenize(text string) []token {
+	t := tokenizer{segment: hasCJK(text)}
+	return append(t.feed(text), t.finish()...)
+}
+
+// document is tokenized text along with its structure
+type document struct {
+	title      string // from the page's <title>, if it had one
+	words      []string
+	paragraphs []int // indices of words that begin a paragraph
+	headings   []int // indices of words that begin a heading, a subset of paragraphs
+	code       []int // indices of words that are inline code
+	broken     bool  // the last word ends a paragraph
+
+	// Documents read from a queue of files record where each one begins
+	files     []int // indices of words that begin each file
+	fileNames []string
+}
+
+// startFile marks the start of the next file in a queue, which begins a new
+// paragraph. A previous file without any words is forgotten.
+func (d *document) startFile(name string) {
+	if n := len(d.files); n > 0 && d.files[n-1] == len(d.words) {
+		d.files, d.fileNames = d.files[:n-1], d.fileNames[:n-1]
+	}
+	d.files = append(d.files, len(d.words))
+	d.fileNames = append(d.fileNames, name)
+	d.broken = true
+}
+
+// add appends tokens to the document
+func (d *document) add(tokens []token) {
+	for _, t := range tokens {
+		if len(d.words) == 0 || d.broken || t.startsParagraph {
+			d.paragraphs = append(d.paragraphs, len(d.words))
+			if t.heading {
+				d.headings = append(d.headings, len(d.words))
+			}
+		}
+		if t.code {
+			d.code = append(d.code, len(d.words))
+		}
+		d.words = append(d.words, t.text)
+		d.broken = t.endsParagraph
+	}
+}
+
+// tokens turns a document back into tokens, so it can be added to another
+func (d document) tokens() []token {
+	out := make([]token, len(d.words))
+	for i, w := range d.words {
+		out[i].text = w
+	}
+	for _, i := range d.code {
+		out[i].code = true
+	}
+	for i, p := range d.paragraphs {
+		end := len(d.words)
+		if i+1 < len(d.paragraphs) {
+			end = d.paragraphs[i+1]
+		}
+		_, heading := slices.BinarySearch(d.headings, p)
+		for j := p; j < end; j++ {
+			out[j].heading = heading
+		}
+		if end < len(d.words) || d.broken {
+			out[end-1].endsParagraph = true
+		}
+	}
+	return out
+}
+
+// parseDocument tokenizes text, recording where each paragraph begins
+func parseDocument(text string) document {
+	var doc document
+	doc.add(tokenize(text))
+	return doc
+}
+
+// sanitizeHTML extracts text content from HTML using html-to-markdown
+func sanitizeHTML(htmlContent []byte) string {
+	md, err := htmltomarkdown.ConvertString(string(htmlContent))
+	if err != nil {
+		return string(htmlContent)
+	}
+
+	return md
+}
+
+// Markdown handling, set from flags: rawMarkdown leaves markup untouched and
+// readCode keeps the contents of fenced code blocks
+var (
+	rawMarkdown bool
+	readCode    bool
+)
+
+// Patterns for markdown syntax that isn't worth reading
+var (
+	mdFence      = regexp.MustCompile("^\\s*(```|~~~)")
+	mdIndented   = regexp.MustCompile(`^( {4}|\t)`)
+	mdHeading    = regexp.MustCompile(`^\s{0,3}#{1,6}\s+|\s+#+\s*$`)
+	mdBlockquote = regexp.MustCompile(`^\s*(>\s?)+`)
+	mdListMarker = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+(\[[ xX]\]\s+)?`)
+	mdRule       = regexp.MustCompile(`^\s*([-*_]\s*){3,}$`)
+	mdReference  = regexp.MustCompile(`^\s{0,3}\[[^\]]+\]:\s*\S+`)
+	mdImage      = regexp.MustCompile(`!\[[^\]]*\](\([^)]*\)|\[[^\]]*\])`)
+	mdLink       = regexp.MustCompile(`\[([^\]]*)\](\([^)]*\)|\[[^\]]*\])`)
+	mdAutolink   = regexp.MustCompile(`<((https?|mailto):[^>\s]+)>`)
+	mdStrong     = regexp.MustCompile(`\*\*([^*]+)\*\*|\b__([^_]+)__\b`)
+	mdEmphasis   = regexp.MustCompile(`\*([^*\s][^*]*)\*|\b_([^_]+)_\b`)
+	mdStrike     = regexp.MustCompile(`~~([^~]+)~~`)
+	mdCodeSpan   = regexp.MustCompile("`+([^`]+)`+")
+	mdEscape     = regexp.MustCompile("\\\\([\\\\`*_{}\\[\\]()#+\\-.!|>])")
+)
+
+// Escaped ASCII punctuation is shifted into the private use area while
+// stripping markdown
+const mdEscaped = '\uE000'
+
+// headingMarker starts a line of stripped markdown that was a heading, so the
+// tokenizer can tell headings apart from body text
+const headingMarker = '\uE100'
+
+// codeMarker starts an inline code span in stripped markdown, whose spaces
+// become codeSpace so the tokenizer keeps the span as one word
+const (
+	codeMarker = '\uE101'
+	codeSpace  = '\uE102'
+)
+
+// stripMarkdown removes markdown syntax, leaving the text a reader would see.
+// Fence delimiters are dropped, and unless keepCode is set each fenced or
+// indented code block is folded into a single ⟨code: N lines⟩ paragraph; line
+// structure is kept so paragraphs survive. Headings become paragraphs of
+// their own, starting with headingMarker.
+func stripMarkdown(text string, keepCode bool) string {
+	s := markdownStripper{keepCode: keepCode}
+	return s.strip(text) + s.finish()
+}
+
+// markdownStripper strips markdown a chunk of whole lines at a time,
+// remembering between chunks whether it's inside a code block and how many
+// lines of code it has folded so far
+type markdownStripper struct {
+	keepCode  bool
+	inCode    bool
+	indented  bool // inside an indented code block
+	codeLines int
+	blanks    int  // blank lines not yet counted in an indented block
+	afterText bool // the last line held text, so indenting can't start code
+	inList    bool // indented lines continue a list item rather than code
+}
+
+func (s *markdownStripper) strip(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if i == len(lines)-1 && line == "" {
+			// Not a line, just the end of the last one
+			break
+		}
+		lines[i] = s.line(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// finish folds a code block left open at the end of the text
+func (s *markdownStripper) finish() string {
+	if s.indented || s.inCode && !s.keepCode {
+		s.indented, s.inCode = false, false
+		return s.fold()
+	}
+	return ""
+}
+
+// fold returns the paragraph standing in for the code block just skipped
+func (s *markdownStripper) fold() string {
+	n := s.codeLines
+	s.codeLines, s.blanks = 0, 0
+	if n == 0 {
+		return ""
+	}
+	unit := "lines"
+	if n == 1 {
+		unit = "line"
+	}
+	return fmt.Sprintf("\n%c⟨code:%c%d%c%s⟩\n", codeMarker, codeSpace, n, codeSpace, unit)
+}
+
+// line strips a single line of markdown
+func (s *markdownStripper) line(line string) string {
+	blank := strings.TrimSpace(line) == ""
+	if s.indented {
+		switch {
+		case blank:
+			s.blanks++
+			return ""
+		case mdIndented.MatchString(line):
+			s.codeLines += s.blanks + 1
+			s.blanks = 0
+			return ""
+		}
+		s.indented = false
+		return s.fold() + "\n" + s.line(line)
+	}
+	if mdFence.MatchString(line) {
+		s.inCode = !s.inCode
+		s.afterText = false
+		if !s.inCode && !s.keepCode {
+			return s.fold()
+		}
+		return ""
+	}
+	if s.inCode {
+		if s.keepCode {
+			return line
+		}
+		s.codeLines++
+		return ""
+	}
+	if blank {
+		s.afterText = false
+		return line
+	}
+	if !s.keepCode && !s.afterText && !s.inList && mdIndented.MatchString(line) {
+		s.indented = true
+		s.codeLines = 1
+		return ""
+	}
+	s.afterText = true
+	switch {
+	case mdListMarker.MatchString(line):
+		s.inList = true
+	case line[0] != ' ' && line[0] != '\t':
+		s.inList = false
+	}
+	if mdRule.MatchString(line) || mdReference.MatchString(line) {
+		return ""
+	}
+	// Hide escaped characters from the patterns below
+	line = mdEscape.ReplaceAllStringFunc(line, func(s string) string {
+		return string(mdEscaped + rune(s[1]))
+	})
+	// Code spans are hidden from them too, and kept whole
+	line = mdCodeSpan.ReplaceAllStringFunc(line, func(s string) string {
+		code := strings.TrimSpace(mdCodeSpan.FindStringSubmatch(s)[1])
+		return string(codeMarker) + strings.Map(func(r rune) rune {
+			switch {
+			case unicode.IsSpace(r):
+				return codeSpace
+			case r < utf8.RuneSelf:
+				return mdEscaped + r
+			}
+			return r
+		}, code)
+	})
+	line = mdBlockquote.ReplaceAllString(line, "")
+	loc := mdHeading.FindStringIndex(line)
+	heading := loc != nil && loc[0] == 0
+	line = mdHeading.ReplaceAllString(line, "")
+	line = mdListMarker.ReplaceAllString(line, "")
+	line = mdImage.ReplaceAllString(line, "")
+	line = mdLink.ReplaceAllString(line, "$1")
+	line = mdAutolink.ReplaceAllString(line, "$1")
+	line = mdStrong.ReplaceAllString(line, "$1$2")
+	line = mdEmphasis.ReplaceAllString(line, "$1$2")
+	line = mdStrike.ReplaceAllString(line, "$1")
+	if heading {
+		line = "\n" + string(headingMarker) + line + "\n"
+		s.afterText = false
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= mdEscaped && r < mdEscaped+utf8.RuneSelf {
+			return r - mdEscaped
+		}
+		return r
+	}, line)
+}
+
+// parseMarkdown tokenizes markdown text from the web, stripping its syntax
+// unless raw markdown was requested
+func parseMarkdown(text string) document {
+	if !rawMarkdown {
+		text = stripMarkdown(text, readCode)
+	}
+	return parseDocument(webText(text))
+}
+
+// keepRefs leaves citations and long URLs in text from the web, set by
+// -keep-refs
+var keepRefs bool
+
+// Patterns for references that aren't worth reading: citation and footnote
+// numbers like [12], [3, 4] or [5–7], standalone or glued to a word, with
+// the spaces before them, and bare URLs
+var (
+	refCitation = regexp.MustCompile(`[ \t]*\[\d+(\s*[-–,]\s*\d+)*\]`)
+	refURL      = regexp.MustCompile(`\b(https?://|www\.)\S+`)
+)
+
+// URLs longer than this are shortened to linkToken
+const (
+	maxURLLength = 30
+	linkToken    = "⟨link⟩"
+)
+
+// How URLs among the words are read, set by -urls: "keep" reads them,
+// "strip" drops them and "placeholder" reads each as linkToken
+var urlMode = "keep"
+
+// splitURL reports whether a word is a URL, returning the punctuation around
+// it
+func splitURL(word string) (lead, trail string, ok bool) {
+	u := strings.TrimLeft(word, "(<[\"'")
+	lead = word[:len(word)-len(u)]
+	trimmed := strings.TrimRight(u, ".,;:!?)]}>'\"")
+	return lead, u[len(trimmed):], isURL(trimmed)
+}
+
+// webText drops citation markers from text from the web and shortens long
+// URLs, unless -keep-refs is set
+func webText(text string) string {
+	if keepRefs {
+		return text
+	}
+	text = refCitation.ReplaceAllString(text, "")
+	return refURL.ReplaceAllStringFunc(text, func(u string) string {
+		trimmed := strings.TrimRight(u, ".,;:!?)]}'\"")
+		if utf8.RuneCountInString(trimmed) <= maxURLLength {
+			return u
+		}
+		return linkToken + u[len(trimmed):]
+	})
+}
+
+// JSON handling, set from flags: the text read from JSON input is the string
+// at jsonPath. Input is taken as JSON by its media type or extension, or
+// always with forceJSON.
+var (
+	jsonPath  string
+	forceJSON bool
+)
+
+// readsJSON reports whether input, detected as JSON or not, should have its
+// text extracted as JSON
+func readsJSON(detected bool) bool {
+	return forceJSON || detected && jsonPath != ""
+}
+
+func isJSONFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+func isJSONMedia(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// splitJSONPath splits a path like data.items[0].body or ["odd.key"] into
+// object keys and array indices
+func splitJSONPath(path string) ([]any, error) {
+	var steps []any
+	for path != "" {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+		case '[':
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in %q", path)
+			}
+			inner := path[1:end]
+			if n, err := strconv.Atoi(inner); err == nil && n >= 0 {
+				steps = append(steps, n)
+			} else if key, err := strconv.Unquote(inner); err == nil {
+				steps = append(steps, key)
+			} else {
+				return nil, fmt.Errorf("bad index [%s]", inner)
+			}
+			path = path[end+1:]
+		default:
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			steps = append(steps, path[:end])
+			path = path[end:]
+		}
+	}
+	return steps, nil
+}
+
+// jsonText returns the text at path in JSON content: a string, or an array
+// of strings joined as paragraphs
+func jsonText(content []byte, path string) (string, error) {
+	steps, err := splitJSONPath(path)
+	if err != nil {
+		return "", err
+	}
+	var v any
+	if err := json.Unmarshal(content, &v); err != nil {
+		return "", fmt.Errorf("invalid JSON: %w", err)
+	}
+	at := "the top level"
+	for _, step := range steps {
+		switch step := step.(type) {
+		case string:
+			obj, ok := v.(map[string]any)
+			if !ok {
+				return "", fmt.Errorf("%s is not an object", at)
+			}
+			if v, ok = obj[step]; !ok {
+				return "", fmt.Errorf("no %q in %s", step, at)
+			}
+			at = fmt.Sprintf("%q", step)
+		case int:
+			arr, ok := v.([]any)
+			if !ok {
+				return "", fmt.Errorf("%s is not an array", at)
+			}
+			if step >= len(arr) {
+				return "", fmt.Errorf("%s has no item %d", at, step)
+			}
+			v = arr[step]
+			at = fmt.Sprintf("item %d", step)
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []any:
+		paragraphs := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("%s is not an array of strings", at)
+			}
+			paragraphs[i] = s
+		}
+		return strings.Join(paragraphs, "\n\n"), nil
+	}
+	return "", fmt.Errorf("%s is not text", at)
+}
+
+// newJSONLoader reads the text at jsonPath from JSON in r
+func newJSONLoader(r io.Reader) (*textLoader, error) {
+	r, err := decompress(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	text, err := jsonText(content, jsonPath)
+	if err != nil {
+		return nil, err
+	}
+	return newTextLoader(strings.NewReader(text), nil, false)
+}
+
+// isMarkdownFile reports whether a path has a markdown extension
+func isMarkdownFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// Patterns used to score elements by their class and id attributes
+var (
+	unlikelyCandidates = regexp.MustCompile(`(?i)banner|breadcrumb|combx|comment|community|cookie|consent|disqus|extra|footer|gdpr|header|legends|menu|modal|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|ad-break|agegate|pagination|pager|popup|promo|newsletter|subscribe`)
+	maybeCandidate     = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveCandidate  = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negativeCandidate  = regexp.MustCompile(`(?i)-ad-|hidden|^hid$| hid$| hid |^hid |banner|combx|comment|com-|contact|foot|footer|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+)
+
+// Elements that never contain article content
+var strippedTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Iframe: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+	atom.Form: true, atom.Button: true, atom.Select: true, atom.Svg: true,
+}
+
+// Minimum amount of text the winning candidate must hold to be trusted
+const readerMinTextLength = 250
+
+// extractArticle isolates the main content of an HTML page in the spirit of
+// Mozilla's Readability: boilerplate is pruned, paragraphs score their
+// ancestors, and the best scoring node is returned as HTML. The boolean is
+// false when no candidate is convincing enough to replace the full page.
+func extractArticle(htmlContent []byte) ([]byte, bool) {
+	doc, err := html.Parse(bytes.NewReader(htmlContent))
+	if err != nil {
+		return nil, false
+	}
+
+	pruneBoilerplate(doc)
+
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+	addScore := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			scores[n] = classWeight(n)
+			switch n.DataAtom {
+			case atom.Div, atom.Article, atom.Main, atom.Section:
+				scores[n] += 5
+			case atom.Pre, atom.Td, atom.Blockquote:
+				scores[n] += 3
+			case atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li:
+				scores[n] -= 3
+			case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+				scores[n] -= 5
+			}
+			candidates = append(candidates, n)
+		}
+		scores[n] += score
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.DataAtom == atom.P || n.DataAtom == atom.Pre || n.DataAtom == atom.Td) {
+			text := strings.TrimSpace(nodeText(n))
+			if utf8.RuneCountInString(text) >= 25 {
+				score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+				addScore(n.Parent, score)
+				if n.Parent != nil {
+					addScore(n.Parent.Parent, score/2)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	var best *html.Node
+	bestScore := 0.0
+	for _, n := range candidates {
+		score := scores[n] * (1 - linkDensity(n))
+		if best == nil || score > bestScore {
+			best = n
+			bestScore = score
+		}
+	}
+
+	if best == nil || utf8.RuneCountInString(strings.TrimSpace(nodeText(best))) < readerMinTextLength {
+		return nil, false
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, best); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// pruneBoilerplate removes elements that are unlikely to be part of the article
+func pruneBoilerplate(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode {
+			n.RemoveChild(c)
+		} else if c.Type == html.ElementNode {
+			matchString := attr(c, "class") + " " + attr(c, "id")
+			role := attr(c, "role")
+			unlikely := unlikelyCandidates.MatchString(matchString) && !maybeCandidate.MatchString(matchString)
+			if strippedTags[c.DataAtom] || unlikely || role == "navigation" || role == "complementary" || role == "dialog" || attr(c, "aria-hidden") == "true" {
+				if c.DataAtom != atom.Body && c.DataAtom != atom.A {
+					n.RemoveChild(c)
+					c = next
+					continue
+				}
+			}
+			pruneBoilerplate(c)
+		}
+		c = next
+	}
+}
+
+// classWeight scores a node by whether its class and id look like content
+func classWeight(n *html.Node) float64 {
+	weight := 0.0
+	for _, s := range []string{attr(n, "class"), attr(n, "id")} {
+		if s == "" {
+			continue
+		}
+		if negativeCandidate.MatchString(s) {
+			weight -= 25
+		}
+		if positiveCandidate.MatchString(s) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// linkDensity returns the fraction of a node's text that sits inside links
+func linkDensity(n *html.Node) float64 {
+	textLength := len(nodeText(n))
+	if textLength == 0 {
+		return 0
+	}
+	linkLength := 0
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.ElementNode && c.DataAtom == atom.A {
+			linkLength += len(nodeText(c))
+			return
+		}
+		for cc := c.FirstChild; cc != nil; cc = cc.NextSibling {
+			walk(cc)
+		}
+	}
+	walk(n)
+	return float64(linkLength) / float64(textLength)
+}
+
+// nodeText concatenates all text beneath a node
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.TextNode {
+			sb.WriteString(c.Data)
+		}
+		for cc := c.FirstChild; cc != nil; cc = cc.NextSibling {
+			walk(cc)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+// attr returns the value of an attribute, or "" when unset
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// Fetch caching, set from flags: offline reads only from the cache, cached
+// pages younger than cacheTTL are used without asking the server, and
+// refetch always downloads pages afresh
+var (
+	offline  bool
+	refetch  bool
+	cacheTTL = 24 * time.Hour
+)
+
+var errNotCached = errors.New("not in the cache, and offline")
+
+// Extra headers sent when fetching pages, from -header and the auth flags;
+// they replace any default of the same name
+var requestHeaders = http.Header{}
+
+// Proxy used for fetching, from -proxy; nil falls back to HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY from the environment
+var proxyURL *url.URL
+
+// parseProxy parses a -proxy value. A bare host:port means an HTTP proxy.
+func parseProxy(s string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q: must be http, https or socks5", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, errors.New("missing host")
+	}
+	return u, nil
+}
+
+// httpClient returns a client for fetching that goes through the proxy
+func httpClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport, CheckRedirect: checkRedirect}
+}
+
+// Redirects followed before a fetch gives up, as net/http does by default
+const maxRedirects = 10
+
+// checkRedirect follows redirects, including between http and https, but
+// keeps credentials and the other extra headers to the host they were meant
+// for. net/http would still send them on to its subdomains.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if !strings.EqualFold(req.URL.Hostname(), via[0].URL.Hostname()) {
+		for name := range requestHeaders {
+			req.Header.Del(name)
+		}
+		req.Header.Del("Authorization")
+		req.Header.Del("Cookie")
+	}
+	return nil
+}
+
+// headerFlag collects repeated -header "Name: Value" flags
+type headerFlag http.Header
+
+func (f headerFlag) String() string { return "" }
+
+func (f headerFlag) Set(v string) error {
+	name, value, ok := strings.Cut(v, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("must be \"Name: Value\"")
+	}
+	http.Header(f).Add(name, strings.TrimSpace(value))
+	return nil
+}
+
+// cachedPage is a fetched page as stored in the cache
+type cachedPage struct {
+	URL          string    `json:"url"`
+	Fetched      time.Time `json:"fetched"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	MediaType    string    `json:"media_type,omitempty"`
+	Content      string    `json:"content"`
+	Title        string    `json:"title,omitempty"`
+	Text         string    `json:"text,omitempty"` // readable text of an HTML page
+
+	stale bool // returned from the cache because fetching failed
+}
+
+// extract keeps the title and readable text of an HTML page with it, so a
+// cached copy is read without converting it again
+func (p *cachedPage) extract() {
+	switch p.MediaType {
+	case "", "text/html", "application/xhtml+xml":
+	default:
+		return
+	}
+	content := []byte(p.Content)
+	if sniffFeed(content) {
+		return
+	}
+	p.Title = htmlTitle(content)
+	p.Text = sanitizeHTML(content)
+}
+
+// title returns the page's title, for pages cached before titles were kept
+// as well
+func (p cachedPage) title() string {
+	if p.Title != "" {
+		return p.Title
+	}
+	return htmlTitle([]byte(p.Content))
+}
+
+// document tokenizes the page, from its readable text where that was kept
+// and otherwise as urlDocument does
+func (p cachedPage) document(reader bool) (document, error) {
+	if p.Text == "" || reader || forceJSON {
+		return urlDocument([]byte(p.Content), p.MediaType, reader)
+	}
+	doc := parseMarkdown(p.Text)
+	doc.title = p.Title
+	return doc, nil
+}
+
+// staleNotice says that a page is an old copy from the cache
+func (p cachedPage) staleNotice() string {
+	return "Showing cached copy from " + p.Fetched.Local().Format("2 Jan 2006 15:04")
+}
+
+// pageCacheDir returns the directory fetched pages are cached in
+func pageCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "skim", "pages"), nil
+}
+
+// pageCachePath returns where a URL's page is cached
+func pageCachePath(urlStr string) (string, error) {
+	dir, err := pageCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(urlStr))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// loadCachedPage reads a URL's page from the cache
+func loadCachedPage(urlStr string) (cachedPage, bool) {
+	var page cachedPage
+	path, err := pageCachePath(urlStr)
+	if err != nil {
+		return page, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || json.Unmarshal(data, &page) != nil || page.URL != urlStr {
+		return page, false
+	}
+	return page, true
+}
+
+// storeCachedPage writes a page to the cache, replacing the file atomically
+func storeCachedPage(page cachedPage) error {
+	path, err := pageCachePath(page.URL)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(page)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// fetchPage fetches a page through the cache: a fresh copy is used as is,
+// and a stale one is revalidated with a conditional request. If fetching
+// fails, any cached copy is returned instead, marked stale.
+func fetchPage(ctx context.Context, urlStr string) (cachedPage, error) {
+	cached, ok := loadCachedPage(urlStr)
+	if offline && !ok {
+		return cachedPage{}, errNotCached
+	}
+	if offline {
+		return cached, nil
+	}
+	if len(requestHeaders) > 0 || hasCredentials(urlStr) {
+		// What a page holds may depend on the credentials sent, so the
+		// cache is bypassed
+		return downloadRetrying(ctx, urlStr, nil)
+	}
+	if ok && !refetch && time.Since(cached.Fetched) < cacheTTL {
+		return cached, nil
+	}
+	var prev *cachedPage
+	if ok && !refetch {
+		prev = &cached
+	}
+	page, err := downloadRetrying(ctx, urlStr, prev)
+	if err != nil && ok && ctx.Err() == nil {
+		cached.stale = true
+		return cached, nil
+	}
+	if err != nil {
+		return cachedPage{}, err
+	}
+	// The cache only saves time, so failing to write it isn't an error
+	storeCachedPage(page)
+	return page, nil
+}
+
+// fetchUncached downloads a page without reading or writing the cache
+func fetchUncached(ctx context.Context, urlStr string) (cachedPage, error) {
+	return downloadRetrying(ctx, urlStr, nil)
+}
+
+// listCachedPages returns the cached pages, most recently fetched first
+func listCachedPages() ([]cachedPage, error) {
+	dir, err := pageCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var pages []cachedPage
+	for _, f := range files {
+		var page cachedPage
+		data, err := os.ReadFile(f)
+		if err != nil || json.Unmarshal(data, &page) != nil || page.URL == "" {
+			continue
+		}
+		pages = append(pages, page)
+	}
+	slices.SortFunc(pages, func(a, b cachedPage) int {
+		return b.Fetched.Compare(a.Fetched)
+	})
+	return pages, nil
+}
+
+// printCachedPages writes a numbered list of cached pages, for -cached
+func printCachedPages(w io.Writer, pages []cachedPage) {
+	if len(pages) == 0 {
+		fmt.Fprintln(w, "No cached pages")
+		return
+	}
+	for i, p := range pages {
+		title := p.URL
+		if t := p.title(); t != "" {
+			title = t
+		}
+		fmt.Fprintf(w, "%3d  %s  %s\n", i+1, p.Fetched.Local().Format("2 Jan 2006 15:04"), title)
+		if title != p.URL {
+			fmt.Fprintf(w, "     %s\n", p.URL)
+		}
+	}
+}
+
+// Retries for failed fetches, set from flags. The wait doubles after each
+// attempt unless the server asks for longer with Retry-After.
+var (
+	fetchRetries = 3
+	retryWait    = time.Second
+)
+
+// Longest a single fetch attempt may take, set from -timeout
+var fetchTimeout = 30 * time.Second
+
+// Longest a fetch may take across all its attempts, unless one attempt is
+// allowed longer
+const fetchDeadline = 2 * time.Minute
+
+// retryableError is a fetch failure worth trying again: a connection error,
+// or a 5xx or 429 response with any wait the server asked for
+type retryableError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// downloadRetrying downloads a page, retrying transient failures with
+// exponential backoff as long as the fetch deadline allows
+func downloadRetrying(ctx context.Context, urlStr string, prev *cachedPage) (cachedPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, max(fetchDeadline, fetchTimeout))
+	defer cancel()
+	wait := retryWait
+	for attempt := 0; ; attempt++ {
+		page, err := download(ctx, urlStr, prev)
+		var retry *retryableError
+		if !errors.As(err, &retry) || attempt >= fetchRetries {
+			return page, err
+		}
+		delay := max(wait, retry.after)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return page, err
+		}
+		select {
+		case <-ctx.Done():
+			return page, err
+		case <-time.After(delay):
+		}
+		wait *= 2
+	}
+}
+
+// retryAfter parses a Retry-After header, given in seconds or as a date
+func retryAfter(header string) time.Duration {
+	if secs, err := strconv.Atoi(strings.TrimSpace(header)); err == nil {
+		return time.Duration(max(0, secs)) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return max(0, time.Until(t))
+	}
+	return 0
+}
+
+// transient reports whether a failed request might succeed if tried again:
+// timeouts, dropped or refused connections and bodies cut short. Errors such
+// as a bad certificate or an unknown host fail the same way every time.
+func transient(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// download fetches a page within the fetch timeout. Given a previously
+// fetched copy it asks the server whether the page has changed, reusing the
+// copy if not.
+func download(ctx context.Context, urlStr string, prev *cachedPage) (cachedPage, error) {
+	client := httpClient(fetchTimeout)
+	// The deadline also covers reading the body once the client returns
+	attemptCtx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(attemptCtx, "GET", urlStr, nil)
+	if err != nil {
+		return cachedPage{}, err
+	}
+
+	// Set user agent to avoid being blocked by some servers
+	req.Header.Set("User-Agent", "skim/1.0 (+https://github.com/varunrandery/skim)")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/markdown,text/plain;q=0.9,*/*;q=0.1")
+	// Asking explicitly turns off the transport's own gzip handling, so
+	// decodeBody undoes whichever encoding the server chose
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	for name, values := range requestHeaders {
+		req.Header[name] = values
+	}
+	if host := requestHeaders.Get("Host"); host != "" {
+		req.Host = host
+	}
+	if prev != nil {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil && ctx.Err() == nil && transient(err) {
+		return cachedPage{}, &retryableError{err: err}
+	}
+	if err != nil {
+		return cachedPage{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && prev != nil {
+		page := *prev
+		page.Fetched = time.Now()
+		return page, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("HTTP %d: %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+		if final := resp.Request.URL.Redacted(); final != redactURL(urlStr) {
+			err = fmt.Errorf("%w from %s", err, final)
+		}
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return cachedPage{}, &retryableError{err: err, after: retryAfter(resp.Header.Get("Retry-After"))}
+		}
+		return cachedPage{}, err
+	}
+
+	// A compressed body only grows, so its length can rule a page out early
+	if resp.ContentLength > maxFetchSize {
+		return cachedPage{}, fmt.Errorf("content too large (%s, limit %s)", byteSize(resp.ContentLength), byteSize(maxFetchSize))
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if unreadableMedia(mediaType) {
+		return cachedPage{}, fmt.Errorf("can't read %s content", mediaType)
+	}
+
+	decoded, err := decodeBody(resp.Body, resp.Header.Get("Content-Encoding"))
+	if err != nil {
+		return cachedPage{}, err
+	}
+	raw, err := io.ReadAll(io.LimitReader(decoded, maxFetchSize+1))
+	if err != nil {
+		return cachedPage{}, err
+	}
+	if int64(len(raw)) > maxFetchSize {
+		return cachedPage{}, fmt.Errorf("content too large (over %s limit)", byteSize(maxFetchSize))
+	}
+
+	content, err := decodeFetched(raw, contentType, mediaType)
+	if err != nil {
+		return cachedPage{}, err
+	}
+	page := cachedPage{
+		URL:          urlStr,
+		Fetched:      time.Now(),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		MediaType:    mediaType,
+		Content:      content,
+	}
+	page.extract()
+	return page, nil
+}
+
+// xmlEncoding finds the encoding named in an XML declaration
+var xmlEncoding = regexp.MustCompile(`^\s*<\?xml[^>]*\sencoding\s*=\s*["']([^"']+)["']`)
+
+// decodeFetched decodes a response body to UTF-8. A charset in the
+// Content-Type wins. Otherwise HTML is sniffed for a BOM or <meta>
+// declaration, XML follows its declaration, and anything else is read as
+// UTF-8 or UTF-16 the way files are.
+func decodeFetched(raw []byte, contentType, mediaType string) (string, error) {
+	label := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		label = params["charset"]
+	}
+	switch {
+	case label != "":
+	case mediaType == "" || mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		body, err := charset.NewReader(bytes.NewReader(raw), contentType)
+		if err != nil {
+			return "", err
+		}
+		content, err := io.ReadAll(body)
+		return string(content), err
+	case isFeedMedia(mediaType) || sniffFeed(raw):
+		if m := xmlEncoding.FindSubmatch(raw[:min(len(raw), 1024)]); m != nil {
+			label = string(m[1])
+		}
+	}
+	if label != "" {
+		if enc, _ := charset.Lookup(label); enc != nil {
+			content, err := enc.NewDecoder().Bytes(raw)
+			return string(content), err
+		}
+	}
+	if text, ok := decodeText(raw); ok {
+		return text, nil
+	}
+	return string(raw), nil
+}
+
+// decodeBody undoes a response's Content-Encoding
+func decodeBody(body io.Reader, encoding string) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		return zlib.NewReader(body)
+	case "br":
+		return brotli.NewReader(body), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+}
+
+// Largest response body fetchURL will read, set by -max-fetch-size
+var maxFetchSize int64 = 10 << 20
+
+// byteSize is a size in bytes, written with an optional KB, MB or GB suffix
+type byteSize int64
+
+func (b byteSize) String() string {
+	switch {
+	case b >= 1<<30:
+		return fmt.Sprintf("%.3gGB", float64(b)/(1<<30))
+	case b >= 1<<20:
+		return fmt.Sprintf("%.3gMB", float64(b)/(1<<20))
+	case b >= 1<<10:
+		return fmt.Sprintf("%.3gKB", float64(b)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", int64(b))
+}
+
+// parseByteSize parses sizes like "10MB", "512k" or "1048576"
+func parseByteSize(spec string) (byteSize, error) {
+	s := strings.ToUpper(strings.TrimSpace(spec))
+	units := []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"G", 1 << 30}, {"MB", 1 << 20}, {"M", 1 << 20}, {"KB", 1 << 10}, {"K", 1 << 10}, {"B", 1}}
+	mult := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSuffix(s, u.suffix), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", spec)
+	}
+	return byteSize(n * float64(mult)), nil
+}
+
+// unreadableMedia reports whether a media type is one skim has no way to read
+func unreadableMedia(mediaType string) bool {
+	for _, prefix := range []string{"image/", "audio/", "video/", "font/"} {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	switch mediaType {
+	case "application/pdf", "application/zip", "application/octet-stream":
+		return true
+	}
+	return false
+}
+
+// urlDocument tokenizes fetched content according to its media type,
+// extracting readable text from HTML and passing other text through
+func urlDocument(content []byte, mediaType string, reader bool) (document, error) {
+	if readsJSON(isJSONMedia(mediaType)) {
+		text, err := jsonText(content, jsonPath)
+		return parseDocument(webText(text)), err
+	}
+	if isFeedMedia(mediaType) || sniffFeed(content) {
+		if f, ok := parseFeed(content, ""); ok {
+			return feedDocument(f), nil
+		}
+	}
+	switch mediaType {
+	case "text/markdown", "text/x-markdown":
+		return parseMarkdown(string(content)), nil
+	case "", "text/html", "application/xhtml+xml":
+	default:
+		if isSubtitles(string(content)) {
+			var s subtitleStripper
+			return parseDocument(s.strip(string(content))), nil
+		}
+		return parseDocument(webText(string(content))), nil
+	}
+
+	title := htmlTitle(content)
+	if reader {
+		if article, ok := extractArticle(content); ok {
+			content = article
+		}
+	}
+	doc := parseMarkdown(sanitizeHTML(content))
+	doc.title = title
+	return doc, nil
+}
+
+// htmlTitle returns the text of a page's <title>
+func htmlTitle(content []byte) string {
+	z := html.NewTokenizer(bytes.NewReader(content))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken:
+			switch name, _ := z.TagName(); string(name) {
+			case "title":
+				z.Next()
+				return strings.Join(strings.Fields(string(z.Text())), " ")
+			case "body":
+				return ""
+			}
+		}
+	}
+}
+
+// fetchCmd fetches a URL in the background, through the page cache if cache
+// is set, and reports the result as a fetchedMsg, with a feed's entries
+// listed rather than read in one go
+func fetchCmd(ctx context.Context, urlStr string, reader, cache bool) tea.Cmd {
+	return func() tea.Msg {
+		fetch := fetchUncached
+		if cache {
+			fetch = fetchPage
+		}
+		page, err := fetch(ctx, urlStr)
+		if err != nil {
+			return fetchedMsg{url: urlStr, err: err}
+		}
+		var notice string
+		if page.stale {
+			notice = page.staleNotice()
+		}
+		content := []byte(page.Content)
+		if isFeedMedia(page.MediaType) || sniffFeed(content) {
+			if f, ok := parseFeed(content, urlStr); ok {
+				return fetchedMsg{url: urlStr, feed: &f, notice: notice}
+			}
+		}
+		doc, err := page.document(reader)
+		return fetchedMsg{url: urlStr, doc: doc, notice: notice, err: err}
+	}
+}
+
+// feed is a parsed RSS or Atom feed
+type feed struct {
+	title   string
+	entries []feedEntry
+}
+
+type feedEntry struct {
+	title   string
+	link    string
+	content string    // HTML
+	date    time.Time // when published, or zero if the feed doesn't say
+}
+
+// Shapes of RSS 2.0, RSS 1.0 (RDF) and Atom documents, decoded together
+// since they share little beyond the root element's name
+type xmlFeed struct {
+	XMLName xml.Name
+	Title   string `xml:"title"`
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []rssItem   `xml:"item"` // RSS 1.0 puts items beside the channel
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Links       []string `xml:"link"` // atom:link elements may sit beside the plain one
+	Description string   `xml:"description"`
+	Encoded     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string   `xml:"pubDate"`
+	Date        string   `xml:"http://purl.org/dc/elements/1.1/ date"` // RSS 1.0
+}
+
+type atomEntry struct {
+	Title string `xml:"title"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Content   atomText `xml:"content"`
+	Summary   atomText `xml:"summary"`
+	Published string   `xml:"published"`
+	Updated   string   `xml:"updated"`
+}
+
+// atomText is Atom content, which is escaped HTML or text unless its type
+// is xhtml, when it is inline markup
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+func (t atomText) html() string {
+	if t.Type == "xhtml" {
+		return t.Inner
+	}
+	return t.Text
+}
+
+// Date layouts seen in feeds: RFC 822 in RSS, with and without the weekday and
+// with numeric or named zones, and RFC 3339 in Atom and Dublin Core
+var feedDateLayouts = []string{
+	time.RFC1123Z, time.RFC1123, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700", "2 Jan 2006 15:04:05 MST", time.RFC3339, time.DateOnly,
+}
+
+// feedDate parses an entry's date, returning zero if it can't be read
+func feedDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// sniffFeed reports whether content starts like a feed, for feeds served
+// under a text or HTML media type
+func sniffFeed(content []byte) bool {
+	head := bytes.TrimLeft(content[:min(len(content), 1024)], "\ufeff \t\r\n")
+	if bytes.HasPrefix(head, []byte("<?xml")) {
+		return true
+	}
+	for _, root := range []string{"<rss", "<feed", "<rdf:RDF"} {
+		if bytes.HasPrefix(head, []byte(root)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFeedMedia reports whether content of a media type could be a feed
+func isFeedMedia(mediaType string) bool {
+	switch mediaType {
+	case "application/xml", "text/xml":
+		return true
+	case "application/xhtml+xml":
+		return false
+	}
+	return strings.HasSuffix(mediaType, "+xml")
+}
+
+// parseFeed parses an RSS or Atom feed fetched from base, reporting false
+// when content is some other XML
+func parseFeed(content []byte, base string) (feed, bool) {
+	d := xml.NewDecoder(bytes.NewReader(content))
+	// Fetched content is already UTF-8, whatever the declaration says
+	d.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	d.Strict = false
+	var x xmlFeed
+	if err := d.Decode(&x); err != nil {
+		return feed{}, false
+	}
+
+	baseURL, _ := url.Parse(base)
+	resolve := func(link string) string {
+		link = strings.TrimSpace(link)
+		if u, err := url.Parse(link); err == nil && link != "" && baseURL != nil {
+			return baseURL.ResolveReference(u).String()
+		}
+		return link
+	}
+
+	var f feed
+	switch x.XMLName.Local {
+	case "rss", "RDF":
+		f.title = x.Channel.Title
+		for _, item := range append(x.Channel.Items, x.Items...) {
+			content := item.Encoded
+			if content == "" {
+				content = item.Description
+			}
+			e := feedEntry{title: item.Title, content: content, date: feedDate(cmp.Or(item.PubDate, item.Date))}
+			for _, link := range item.Links {
+				if strings.TrimSpace(link) != "" {
+					e.link = resolve(link)
+					break
+				}
+			}
+			f.entries = append(f.entries, e)
+		}
+	case "feed":
+		f.title = x.Title
+		for _, entry := range x.Entries {
+			e := feedEntry{title: entry.Title, content: entry.Content.html(), date: feedDate(cmp.Or(entry.Published, entry.Updated))}
+			if e.content == "" {
+				e.content = entry.Summary.html()
+			}
+			for _, link := range entry.Links {
+				if link.Rel == "" || link.Rel == "alternate" {
+					e.link = resolve(link.Href)
+					break
+				}
+			}
+			f.entries = append(f.entries, e)
+		}
+	default:
+		return feed{}, false
+	}
+	f.title = strings.TrimSpace(f.title)
+	// Newest first, whatever order the feed lists them in; undated entries
+	// keep their order after the rest
+	slices.SortStableFunc(f.entries, func(a, b feedEntry) int { return b.date.Compare(a.date) })
+	for i := range f.entries {
+		// Titles are often escaped HTML
+		f.entries[i].title = strings.Join(strings.Fields(html.UnescapeString(f.entries[i].title)), " ")
+		if f.entries[i].title == "" {
+			f.entries[i].title = "(untitled)"
+		}
+	}
+	return f, true
+}
+
+// Entries with fewer words than this are summaries, so choosing one fetches
+// the full article from its link
+const feedMinWords = 150
+
+// entryDocument tokenizes a feed entry's content
+func entryDocument(e feedEntry) document {
+	doc := parseMarkdown(sanitizeHTML([]byte(e.content)))
+	doc.title = e.title
+	return doc
+}
+
+// feedDocument reads a whole feed as one document, each entry under its
+// title as a heading
+func feedDocument(f feed) document {
+	var text strings.Builder
+	for _, e := range f.entries {
+		text.WriteString("# " + e.title + "\n\n" + sanitizeHTML([]byte(e.content)) + "\n\n")
+	}
+	doc := parseMarkdown(text.String())
+	doc.title = f.title
+	return doc
+}
+
+// Free dictionary API used to look up words
+const dictionaryURL = "https://api.dictionaryapi.dev/api/v2/entries/en/"
+
+// How long a dictionary lookup may take before giving up
+const lookupTimeout = 5 * time.Second
+
+// Most senses shown for a word
+const maxSenses = 5
+
+// definition is a dictionary entry, reduced to what fits on screen
+type definition struct {
+	word     string
+	phonetic string
+	senses   []sense // empty when the word isn't in the dictionary
+}
+
+type sense struct {
+	partOfSpeech string
+	text         string
+}
+
+// dictionaryForm strips a word down to what's worth looking up: surrounding
+// punctuation goes, along with any possessive
+func dictionaryForm(word string) string {
+	word = strings.TrimFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, suffix := range []string{"'s", "’s"} {
+		word = strings.TrimSuffix(word, suffix)
+	}
+	return strings.ToLower(word)
+}
+
+// singular naively stems a plural, reporting false for words that don't
+// look like one
+func singular(word string) (string, bool) {
+	switch {
+	case len(word) <= 3 || strings.HasSuffix(word, "ss"):
+		return word, false
+	case strings.HasSuffix(word, "ies"):
+		return strings.TrimSuffix(word, "ies") + "y", true
+	case strings.HasSuffix(word, "ches"), strings.HasSuffix(word, "shes"),
+		strings.HasSuffix(word, "xes"), strings.HasSuffix(word, "sses"):
+		return strings.TrimSuffix(word, "es"), true
+	case strings.HasSuffix(word, "s"):
+		return strings.TrimSuffix(word, "s"), true
+	}
+	return word, false
+}
+
+// lookupWord fetches a word's definition, returning one without senses if
+// the dictionary doesn't have it
+func lookupWord(ctx context.Context, word string) (definition, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", dictionaryURL+url.PathEscape(word), nil)
+	if err != nil {
+		return definition{}, err
+	}
+	req.Header.Set("User-Agent", "skim/1.0 (+https://github.com/varunrandery/skim)")
+	resp, err := httpClient(lookupTimeout).Do(req)
+	if err != nil {
+		return definition{}, err
+	}
+	defer resp.Body.Close()
+
+	def := definition{word: word}
+	if resp.StatusCode == http.StatusNotFound {
+		return def, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return def, fmt.Errorf("HTTP %d: %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	var entries []struct {
+		Phonetic string `json:"phonetic"`
+		Meanings []struct {
+			PartOfSpeech string `json:"partOfSpeech"`
+			Definitions  []struct {
+				Definition string `json:"definition"`
+			} `json:"definitions"`
+		} `json:"meanings"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&entries); err != nil {
+		return def, err
+	}
+	for _, e := range entries {
+		if def.phonetic == "" {
+			def.phonetic = e.Phonetic
+		}
+		for _, m := range e.Meanings {
+			for _, d := range m.Definitions {
+				if len(def.senses) < maxSenses {
+					def.senses = append(def.senses, sense{m.PartOfSpeech, d.Definition})
+				}
+			}
+		}
+	}
+	return def, nil
+}
+
+// definedMsg carries the result of looking up a word
+type definedMsg struct {
+	word string // as looked up, before any stemming
+	def  definition
+	err  error
+}
+
+// defineCmd looks up a word in the background, falling back to its
+// singular form when the word itself isn't found
+func defineCmd(word string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+		defer cancel()
+		def, err := lookupWord(ctx, word)
+		if stem, ok := singular(word); ok && err == nil && len(def.senses) == 0 {
+			def, err = lookupWord(ctx, stem)
+		}
+		return definedMsg{word: word, def: def, err: err}
+	}
+}
+
+// lookupError explains a failed lookup, which is most often down to being offline
+func lookupError(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "The dictionary took too long to answer. Are you offline?"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return "Couldn't reach the dictionary. Are you offline?"
+	}
+	return fmt.Sprintf("Dictionary lookup failed: %v", err)
+}
+
+// isURL checks if a string is a valid URL
+func isURL(str string) bool {
+	_, err := url.ParseRequestURI(str)
+	if err != nil {
+		return false
+	}
+
+	u, err := url.Parse(str)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+
+	return true
+}
+
+// isBinaryFile checks if content appears to be binary by looking for null bytes
+func isBinaryFile(content []byte) bool {
+	checkSize := min(8192, len(content))
+	for i := 0; i < checkSize; i++ {
+		if content[i] == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// graphemes splits a string into user-perceived characters
+func graphemes(s string) []string {
+	var clusters []string
+	g := uniseg.NewGraphemes(s)
+	for g.Next() {
+		clusters = append(clusters, g.Str())
+	}
+	return clusters
+}
+
+// decodeText converts file content to UTF-8, honoring byte order marks and
+// falling back to Windows-1252 (a superset of Latin-1) for invalid UTF-8.
+// It reports false when the decoded content still looks binary.
+func decodeText(content []byte) (string, bool) {
+	enc, bom := detectEncoding(content)
+	content = content[bom:]
+	if enc != nil {
+		decoded, err := enc.NewDecoder().Bytes(content)
+		if err != nil {
+			return "", false
+		}
+		content = decoded
+	}
+
+	if isBinaryFile(content) {
+		return "", false
+	}
+	return string(content), true
+}
+
+// detectEncoding picks the encoding of text starting with head, returning
+// nil for UTF-8 along with the length of any UTF-8 byte order mark to skip
+func detectEncoding(head []byte) (encoding.Encoding, int) {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		return nil, 3
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return unicodeenc.UTF16(unicodeenc.LittleEndian, unicodeenc.ExpectBOM), 0
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return unicodeenc.UTF16(unicodeenc.BigEndian, unicodeenc.ExpectBOM), 0
+	}
+	if order, ok := sniffUTF16(head); ok {
+		return unicodeenc.UTF16(order, unicodeenc.IgnoreBOM), 0
+	}
+	if !utf8.Valid(head) {
+		return charmap.Windows1252, 0
+	}
+	return nil, 0
+}
+
+// sniffUTF16 detects BOM-less UTF-16 by the zero high bytes that ASCII
+// characters leave on every other position
+func sniffUTF16(content []byte) (unicodeenc.Endianness, bool) {
+	checkSize := min(8192, len(content)) &^ 1
+	if checkSize < 4 {
+		return unicodeenc.LittleEndian, false
+	}
+	var evenZeros, oddZeros int
+	for i := 0; i < checkSize; i++ {
+		if content[i] == 0 {
+			if i%2 == 0 {
+				evenZeros++
+			} else {
+				oddZeros++
+			}
+		}
+	}
+	pairs := checkSize / 2
+	switch {
+	case oddZeros > pairs*2/5 && evenZeros <= pairs/20:
+		return unicodeenc.LittleEndian, true
+	case evenZeros > pairs*2/5 && oddZeros <= pairs/20:
+		return unicodeenc.BigEndian, true
+	}
+	return unicodeenc.LittleEndian, false
+}
+
+var (
+	errBinaryFile = errors.New("cannot open binary file")
+	errNoWords    = errors.New("no words found")
+)
+
+// Bytes sniffed to detect the encoding of streamed text
+const sniffSize = 8192
+
+// Most text a compressed file may expand to, so a small archive can't fill
+// memory
+const maxDecompressedSize = 512 << 20
+
+// compressedExtensions are stripped before a file's type is judged by its
+// extension, so notes.md.gz still reads as markdown
+var compressedExtensions = []string{".gz", ".bz2"}
+
+// trimCompressedExt returns path without a trailing compression extension
+func trimCompressedExt(path string) string {
+	for _, ext := range compressedExtensions {
+		if strings.HasSuffix(strings.ToLower(path), ext) {
+			return path[:len(path)-len(ext)]
+		}
+	}
+	return path
+}
+
+// decompressReader reports corrupt data and output past the size cap as
+// errors rather than handing on garbage
+type decompressReader struct {
+	r io.Reader
+	n int64
+}
+
+func (d *decompressReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.n += int64(n)
+	if d.n > maxDecompressedSize {
+		return n, fmt.Errorf("decompressed text is larger than %s", byteSize(maxDecompressedSize))
+	}
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("failed to decompress: %w", err)
+	}
+	return n, err
+}
+
+// decompress unwraps gzip or bzip2 data, recognized by its magic bytes, and
+// returns any other stream unchanged
+func decompress(br *bufio.Reader) (io.Reader, error) {
+	magic, _ := br.Peek(3)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress: %w", err)
+		}
+		return &decompressReader{r: zr}, nil
+	case bytes.Equal(magic, []byte("BZh")):
+		return &decompressReader{r: bzip2.NewReader(br)}, nil
+	}
+	return br, nil
+}
+
+// Approximate amount of text tokenized per chunk while loading
+const loadChunkSize = 256 << 10
+
+// Whether terminal escape sequences and backspace overstrikes are removed
+// from files and piped text, set from -no-strip-ansi
+var stripEscapes = true
+
+// escapeStripper removes terminal escape sequences and resolves backspace
+// overstrikes, as found in colored command output and man pages. A sequence
+// cut off at the end of one chunk is completed by the next.
+type escapeStripper struct {
+	pending string
+}
+
+// strip removes escapes from the next chunk of text; final marks the last
+// chunk, after which nothing is held back
+func (e *escapeStripper) strip(text string, final bool) string {
+	text = e.pending + text
+	e.pending = ""
+	if !strings.ContainsAny(text, "\x1b\b") {
+		return text
+	}
+	// ESC and backspace are ASCII, so they never occur inside a multi-byte
+	// UTF-8 sequence and scanning bytes is safe
+	out := make([]byte, 0, len(text))
+	for i := 0; i < len(text); {
+		switch text[i] {
+		case '\x1b':
+			n, ok := escapeLen(text[i:])
+			if !ok && !final {
+				e.pending = text[i:]
+				return string(out)
+			}
+			if !ok {
+				n = 1
+			}
+			i += n
+		case '\b':
+			// x\bx is bold and _\bx underlined: keep the letter, not the underscore
+			prev, size := utf8.DecodeLastRune(out)
+			next, nextSize := utf8.DecodeRuneInString(text[i+1:])
+			if next == '_' && size > 0 && prev != '_' {
+				i += 1 + nextSize
+			} else {
+				out = out[:len(out)-size]
+				i++
+			}
+		default:
+			out = append(out, text[i])
+			i++
+		}
+	}
+	return string(out)
+}
+
+// escapeLen returns the length of the escape sequence at the start of s,
+// which begins with ESC. A malformed sequence is taken to be just the ESC, and
+// ok is false when s ends before the sequence does.
+func escapeLen(s string) (n int, ok bool) {
+	if len(s) < 2 {
+		return 0, false
+	}
+	switch s[1] {
+	case '[':
+		// CSI: parameter and intermediate bytes, then a final byte
+		for i := 2; i < len(s); i++ {
+			switch c := s[i]; {
+			case c >= 0x40 && c <= 0x7e:
+				return i + 1, true
+			case c < 0x20 || c > 0x3f:
+				return 1, true
+			}
+		}
+		return 0, false
+	case ']', 'P', 'X', '^', '_':
+		// OSC and other strings, ended by BEL or ST (ESC \). They never span
+		// lines, so a newline means the terminator was lost.
+		for i := 2; i < len(s); i++ {
+			switch s[i] {
+			case '\a':
+				return i + 1, true
+			case '\n':
+				return 1, true
+			case '\x1b':
+				if i+1 == len(s) {
+					return 0, false
+				}
+				if s[i+1] == '\\' {
+					return i + 2, true
+				}
+				return 1, true
+			}
+		}
+		return 0, false
+	}
+	// Other escapes: intermediate bytes, then a final byte, like ESC ( B
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= 0x30 && c <= 0x7e:
+			return i + 1, true
+		case c < 0x20 || c > 0x2f:
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+// Patterns for subtitle files: the timing line that starts each cue, an SRT
+// cue number, the markup inside cues, and the start of a WebVTT file
+var (
+	subTiming  = regexp.MustCompile(`^\s*((?:\d+:)?\d{1,2}:\d{2}[,.]\d{3})\s*-->\s*((?:\d+:)?\d{1,2}:\d{2}[,.]\d{3})`)
+	subIndex   = regexp.MustCompile(`^\s*\d+\s*$`)
+	subMarkup  = regexp.MustCompile(`<[^>]*>|\{\\[^}]*\}`)
+	subWebVTT  = regexp.MustCompile(`^WEBVTT\b`)
+	subCueTime = regexp.MustCompile(`(?:(\d+):)?(\d{1,2}):(\d{2})[,.](\d{3})`)
+)
+
+// A silence this long between subtitle cues starts a new paragraph
+const subtitleGap = 4 * time.Second
+
+// isSubtitleFile reports whether a path has a subtitle file extension
+func isSubtitleFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".srt", ".vtt":
+		return true
+	}
+	return false
+}
+
+// isSubtitles reports whether text starts like a WebVTT or SRT file
+func isSubtitles(text string) bool {
+	if subWebVTT.MatchString(text) {
+		return true
+	}
+	lines := strings.SplitN(strings.TrimLeft(text, " \t\r\n"), "\n", 3)
+	return len(lines) >= 2 && subIndex.MatchString(lines[0]) && subTiming.MatchString(lines[1])
+}
+
+// cueTime parses a subtitle timestamp like 01:02:03,456 or 02:03.456
+func cueTime(s string) time.Duration {
+	m := subCueTime.FindStringSubmatch(s)
+	if m == nil {
+		return 0
+	}
+	var t time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second, time.Millisecond} {
+		n, _ := strconv.Atoi(m[i+1])
+		t += time.Duration(n) * unit
+	}
+	return t
+}
+
+// subtitleStripper reduces SRT and WebVTT subtitles to their spoken text a
+// chunk of whole lines at a time. Cue numbers, timings, settings, notes and
+// styling are dropped, and each cue's lines run on into the next so
+// sentences split across cues read as one. Lines repeated from the cue
+// before, as rolling auto-generated captions do, are read once.
+type subtitleStripper struct {
+	inCue   bool
+	cue     []string      // lines of the current cue
+	prev    []string      // lines of the cue before
+	last    string        // the last line kept
+	end     time.Duration // when the previous cue ended
+	started bool
+}
+
+func (s *subtitleStripper) strip(text string) string {
+	var out strings.Builder
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if i == len(lines)-1 && line == "" {
+			break
+		}
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			// A blank line ends a cue or block
+			if s.inCue {
+				s.prev, s.cue = s.cue, nil
+			}
+			s.inCue = false
+			continue
+		}
+		if m := subTiming.FindStringSubmatch(line); m != nil {
+			start := cueTime(m[1])
+			if s.started && start-s.end >= subtitleGap {
+				out.WriteString("\n")
+			}
+			s.end = max(s.end, cueTime(m[2]))
+			s.started = true
+			s.inCue = true
+			continue
+		}
+		if !s.inCue {
+			// Cue numbers and identifiers, the header, and metadata blocks
+			continue
+		}
+		text := strings.Join(strings.Fields(html.UnescapeString(subMarkup.ReplaceAllString(line, ""))), " ")
+		if text == "" || text == s.last || slices.Contains(s.prev, text) {
+			s.cue = append(s.cue, text)
+			continue
+		}
+		s.cue = append(s.cue, text)
+		s.last = text
+		out.WriteString(text + "\n")
+	}
+	return out.String()
+}
+
+// textLoader decodes and tokenizes a stream of text a chunk at a time, so
+// large files and slow pipes don't hold up the reader
+type textLoader struct {
+	r         *bufio.Reader
+	closer    io.Closer // nil if the stream isn't ours to close
+	closeOnce sync.Once
+	tok       tokenizer
+	md        *markdownStripper // nil unless stripping markdown
+	subs      *subtitleStripper // nil unless reading subtitles
+	esc       *escapeStripper   // nil with -no-strip-ansi
+	live      bool              // hand over words as soon as they arrive
+	tail      bool              // wait at the end of the file for more to be written
+	idle      bool              // the last read found nothing new at the end
+}
+
+// newTextLoader prepares to read text from r, detecting its encoding from
+// the first bytes and rejecting binary content. It's the one way text is
+// read, from stdin, files and queues alike; callers need not clean anything
+// beyond what tokenize and the markdown and escape strippers handle.
+func newTextLoader(r io.Reader, closer io.Closer, markdown bool) (*textLoader, error) {
+	r, err := decompress(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReaderSize(r, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	if len(head) == sniffSize {
+		head = trimPartialRune(head)
+	}
+	enc, bom := detectEncoding(head)
+	br.Discard(bom)
+
+	sample := head[bom:]
+	var src io.Reader = br
+	if enc != nil {
+		sample, _, _ = transform.Bytes(enc.NewDecoder(), sample[:len(sample)&^1])
+		src = transform.NewReader(br, enc.NewDecoder())
+	}
+	if isBinaryFile(sample) {
+		return nil, errBinaryFile
+	}
+
+	l := &textLoader{
+		r:      bufio.NewReaderSize(src, 64<<10),
+		closer: closer,
+		tok:    tokenizer{segment: hasCJK(string(sample))},
+	}
+	if markdown {
+		l.md = &markdownStripper{keepCode: readCode}
+	} else if isSubtitles(string(sample)) {
+		l.subs = &subtitleStripper{}
+	}
+	if stripEscapes {
+		l.esc = &escapeStripper{}
+	}
+	return l, nil
+}
+
+// trimPartialRune drops a UTF-8 sequence cut off at the end of b
+func trimPartialRune(b []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// openTextFile starts loading a text file, stripping markdown files unless
+// raw markdown was requested and subtitle files down to their text
+func openTextFile(path string) (*textLoader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	name := trimCompressedExt(path)
+	if readsJSON(isJSONFile(name)) {
+		defer f.Close()
+		return newJSONLoader(f)
+	}
+	l, err := newTextLoader(f, f, isMarkdownFile(name) && !rawMarkdown)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if isSubtitleFile(name) && l.subs == nil {
+		l.subs = &subtitleStripper{}
+	}
+	return l, nil
+}
+
+// How often a followed file is checked for more text at its end
+const followPoll = 250 * time.Millisecond
+
+// follow makes the loader hand over words as soon as they arrive rather than
+// a chunk at a time, and with tail keeps waiting at the end of a file for
+// more to be written, like tail -f
+func (l *textLoader) follow(tail bool) {
+	l.live = true
+	l.tail = tail
+}
+
+// next reads and tokenizes the next chunk of whole lines, reporting whether
+// the end of the text has been reached
+func (l *textLoader) next() ([]token, bool, error) {
+	if l.idle {
+		time.Sleep(followPoll)
+	}
+	var chunk strings.Builder
+	eof := false
+	for chunk.Len() < loadChunkSize {
+		line, err := l.r.ReadSlice('\n')
+		chunk.Write(line)
+		if err == io.EOF && l.tail {
+			l.idle = chunk.Len() == 0
+			break
+		}
+		if err == io.EOF {
+			eof = true
+			break
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			l.close()
+			return nil, true, err
+		}
+		if l.live && l.r.Buffered() == 0 {
+			// Reading on would wait for more to arrive
+			break
+		}
+	}
+
+	text := chunk.String()
+	if l.esc != nil {
+		text = l.esc.strip(text, eof)
+	}
+	if l.subs != nil {
+		text = l.subs.strip(text)
+	}
+	if l.md != nil {
+		text = l.md.strip(text)
+		if eof {
+			text += l.md.finish()
+		}
+	}
+	tokens := l.tok.feed(text)
+	if eof {
+		tokens = append(tokens, l.tok.finish()...)
+		l.close()
+	} else if l.live {
+		tokens = append(tokens, l.tok.flush()...)
+	}
+	return tokens, eof, nil
+}
+
+// Quiet period after a change before a watched file is re-read, since
+// editors often save in several steps
+const watchDebounce = 100 * time.Millisecond
+
+// fileWatcher reports changes to a file. It watches the file's directory so
+// editors that save by renaming a temporary file over the original are seen.
+type fileWatcher struct {
+	w       *fsnotify.Watcher
+	path    string
+	changes chan struct{}
+}
+
+// watchFile starts watching path for changes
+func watchFile(path string) (*fileWatcher, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Add(filepath.Dir(abs)); err != nil {
+		w.Close()
+		return nil, err
+	}
+	fw := &fileWatcher{w: w, path: path, changes: make(chan struct{}, 1)}
+	go fw.run(abs)
+	return fw, nil
+}
+
+// run coalesces bursts of events for the file into single changes, closing
+// the changes channel once the watcher is closed
+func (fw *fileWatcher) run(abs string) {
+	defer close(fw.changes)
+	var settled <-chan time.Time
+	errs := fw.w.Errors
+	for {
+		select {
+		case ev, ok := <-fw.w.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) == abs && ev.Has(fsnotify.Write|fsnotify.Create) {
+				settled = time.After(watchDebounce)
+			}
+		case <-settled:
+			settled = nil
+			select {
+			case fw.changes <- struct{}{}:
+			default:
+			}
+		case _, ok := <-errs:
+			if !ok {
+				errs = nil
+			}
+		}
+	}
+}
+
+func (fw *fileWatcher) close() {
+	fw.w.Close()
+}
+
+// fileChangedMsg carries a watched file's new contents
+type fileChangedMsg struct {
+	doc document
+	err error
+}
+
+// watchCmd waits for the next change to a watched file and re-reads it
+func watchCmd(fw *fileWatcher) tea.Cmd {
+	return func() tea.Msg {
+		if _, ok := <-fw.changes; !ok {
+			return nil
+		}
+		doc, err := readFile(fw.path)
+		return fileChangedMsg{doc: doc, err: err}
+	}
+}
+
+// reloadedMsg carries a file's contents re-read on request
+type reloadedMsg struct {
+	path string
+	doc  document
+	err  error
+}
+
+// reloadCmd re-reads the file at path
+func reloadCmd(path string) tea.Cmd {
+	return func() tea.Msg {
+		doc, err := readFile(path)
+		return reloadedMsg{path: path, doc: doc, err: err}
+	}
+}
+
+// readFile reads the whole of a text file
+func readFile(path string) (document, error) {
+	l, err := openTextFile(path)
+	if err != nil {
+		return document{}, err
+	}
+	return l.readAll()
+}
+
+// dirFiles lists the text files under dir in lexical order, skipping hidden
+// files and directories as the file picker does
+func dirFiles(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && slices.ContainsFunc(textFileExtensions, func(ext string) bool {
+			return strings.HasSuffix(d.Name(), ext)
+		}) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// expandSources turns file, directory and URL arguments into a queue of
+// files and URLs, warning about and skipping directories that can't be read
+func expandSources(args []string, warn io.Writer) []string {
+	var queue []string
+	for _, arg := range args {
+		if info, err := os.Stat(arg); isURL(arg) || err != nil || !info.IsDir() {
+			// Files that can't be opened are reported when they're read
+			queue = append(queue, arg)
+			continue
+		}
+		paths, err := dirFiles(arg)
+		if err != nil {
+			fmt.Fprintf(warn, "Skipping %s: %v\n", arg, err)
+		}
+		queue = append(queue, paths...)
+	}
+	return queue
+}
+
+// chunkLoader is a source of words read a chunk at a time
+type chunkLoader interface {
+	// next returns the next chunk of words, reporting whether it's the last
+	next() ([]token, bool, error)
+	// close abandons loading; it's safe to call more than once and from
+	// another goroutine
+	close()
+}
+
+// urlLoader fetches a page in a queue as a single chunk
+type urlLoader struct {
+	url    string
+	reader bool
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newURLLoader(urlStr string, reader bool) *urlLoader {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &urlLoader{url: urlStr, reader: reader, ctx: ctx, cancel: cancel}
+}
+
+func (l *urlLoader) next() ([]token, bool, error) {
+	defer l.cancel()
+	page, err := fetchPage(l.ctx, l.url)
+	if err != nil {
+		return nil, true, err
+	}
+	doc, err := page.document(l.reader)
+	if err != nil {
+		return nil, true, err
+	}
+	if len(doc.words) == 0 {
+		return nil, true, errNoWords
+	}
+	return doc.tokens(), true, nil
+}
+
+func (l *urlLoader) close() {
+	l.cancel()
+}
+
+// openSource starts loading a file or URL from a queue
+func openSource(src string, reader bool) (chunkLoader, error) {
+	if isURL(src) {
+		return newURLLoader(src, reader), nil
+	}
+	return openTextFile(src)
+}
+
+// sourceName is how a queued file or URL is shown in the status line
+func sourceName(src string) string {
+	if isURL(src) {
+		return redactURL(src)
+	}
+	return filepath.Base(src)
+}
+
+// redactURL hides the password in a URL that carries credentials
+func redactURL(src string) string {
+	if u, err := url.Parse(src); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return src
+}
+
+// hasCredentials reports whether a URL carries a user name and password,
+// which are sent as basic auth
+func hasCredentials(src string) bool {
+	u, err := url.Parse(src)
+	return err == nil && u.User != nil
+}
+
+// readQueue reads files and URLs back to back into one document, warning
+// about and skipping any that can't be read
+func readQueue(srcs []string, reader bool, warn io.Writer) document {
+	var doc document
+	for _, path := range srcs {
+		l, err := openSource(path, reader)
+		if err != nil {
+			fmt.Fprintf(warn, "Skipping %s: %v\n", path, err)
+			continue
+		}
+		doc.startFile(path)
+		for {
+			tokens, done, err := l.next()
+			if err != nil {
+				fmt.Fprintf(warn, "Skipping %s: %v\n", path, err)
+				break
+			}
+			doc.add(tokens)
+			if done {
+				break
+			}
+		}
+	}
+	return doc
+}
+
+// readAll loads the rest of the text into a document
+func (l *textLoader) readAll() (document, error) {
+	var doc document
+	for {
+		tokens, done, err := l.next()
+		if err != nil {
+			return doc, err
+		}
+		doc.add(tokens)
+		if done {
+			return doc, nil
+		}
+	}
+}
+
+// close releases the underlying stream; it's safe to call more than once
+// and from another goroutine
+func (l *textLoader) close() {
+	l.closeOnce.Do(func() {
+		if l.closer != nil {
+			l.closer.Close()
+		}
+	})
+}
+
+// Default columns of context on each side of the ORP, set by -context-width
+const halfWidth = 30
+
+// Words longer than maxWordLength graphemes are shown over several frames of
+// at most frameLength graphemes each
+const (
+	maxWordLength = halfWidth
+	frameLength   = halfWidth * 2 / 3
+)
+
+// numericToken matches numbers with optional sign, currency, separators,
+// decimals, exponent and unit suffix, e.g. "-$1,000,000.50", "6.02e23", "42%"
+var numericToken = regexp.MustCompile(`^[-+±]?[$€£¥]?\d[\d,.'_]*([eE][-+]?\d+)?(%|[kKmMbB]n?)?[.,;:!?)]*$`)
+
+// How overlong words are shown, set by -long-words: "split" across frames
+// or "truncate" with an ellipsis
+var longWords = "split"
+
+// wordFrames splits an overlong word into frames, breaking at punctuation or
+// camelCase humps where possible and marking each cut with a non-breaking
+// hyphen. Numbers are kept whole as long as they fit on screen, since a
+// split number is hard to read.
+func wordFrames(word string) []string {
+	clusters := graphemes(word)
+	if len(clusters) <= maxWordLength {
+		return []string{word}
+	}
+	if len(clusters) <= 2*halfWidth && numericToken.MatchString(word) {
+		return []string{word}
+	}
+	// Only code spans have spaces, and code is always shown in full
+	if longWords == "truncate" && !strings.Contains(word, " ") {
+		return []string{strings.Join(clusters[:maxWordLength-1], "") + "…"}
+	}
+	var frames []string
+	for len(clusters) > frameLength {
+		cut := breakPoint(clusters)
+		frame := strings.Join(clusters[:cut], "")
+		switch {
+		case strings.HasSuffix(frame, " "):
+			// Code breaks between its words without a hyphen
+			frame = strings.TrimRight(frame, " ")
+		case !strings.HasSuffix(frame, "-"):
+			frame += "\u2011"
+		}
+		frames = append(frames, frame)
+		clusters = clusters[cut:]
+	}
+	return append(frames, strings.Join(clusters, ""))
+}
+
+// Characters a long word can be broken after
+const wordBreaks = " -/_.,:;?&=#+~|\\"
+
+// breakPoint picks where to end the next frame of a long word: the latest
+// natural break that keeps frames at least half full, or else the cut that
+// spreads what's left over evenly sized frames
+func breakPoint(clusters []string) int {
+	for i := frameLength; i > frameLength/2; i-- {
+		if strings.Contains(wordBreaks, clusters[i-1]) {
+			return i
+		}
+		prev, _ := utf8.DecodeRuneInString(clusters[i-1])
+		next, _ := utf8.DecodeRuneInString(clusters[i])
+		if unicode.IsLower(prev) && unicode.IsUpper(next) {
+			return i
+		}
+	}
+	n := (len(clusters) + frameLength - 1) / frameLength
+	return (len(clusters) + n - 1) / n
+}
+
+var textFileExtensions = []string{
+	".txt", ".md", ".markdown", ".srt", ".vtt",
+	".go", ".js", ".ts", ".jsx", ".tsx",
+	".py", ".rb", ".rs", ".c", ".h", ".cpp", ".hpp",
+	".java", ".kt", ".swift", ".cs",
+	".html", ".css", ".scss", ".sass", ".less",
+	".json", ".yaml", ".yml", ".toml", ".xml",
+	".sh", ".bash", ".zsh", ".fish",
+	".sql", ".graphql",
+	".vim", ".lua", ".el", ".lisp", ".clj",
+	".r", ".R", ".jl",
+	".tex", ".org", ".rst", ".adoc",
+	".conf", ".cfg", ".ini", ".env",
+	".gitignore", ".dockerignore", ".editorconfig",
+}
+
+// Compressed copies of text files are offered alongside the plain ones
+func init() {
+	for _, ext := range slices.Clone(textFileExtensions) {
+		for _, z := range compressedExtensions {
+			textFileExtensions = append(textFileExtensions, ext+z)
+		}
+	}
+}
+
+type tickMsg time.Time
+
+// breakMsg counts down the micro-break identified by id
+type breakMsg struct {
+	id int
+}
+
+// countdownMsg advances the resume countdown identified by id
+type countdownMsg struct {
+	id int
+}
+
+// clearStatusMsg clears the transient status message identified by id
+type clearStatusMsg struct {
+	id int
+}
+
+// bellDoneMsg stops sending the bell with each frame
+type bellDoneMsg struct{}
+
+// How long the bell is sent with each frame, long enough for one to be drawn
+const bellTime = 100 * time.Millisecond
+
+// clearCountMsg drops a count prefix left waiting for a motion
+type clearCountMsg struct {
+	id int
+}
+
+type fetchedMsg struct {
+	url    string
+	doc    document
+	feed   *feed  // set instead of doc when the URL is a feed
+	notice string // set when the page is an old copy from the cache
+	err    error
+}
+
+type model struct {
+	doc            document
+	words          []string     // doc.words
+	loader         chunkLoader  // non-nil while the document is still loading
+	watcher        *fileWatcher // set with -watch to reload the file on change
+	heldReload     *document    // a change to the watched file, held while typing
+	following      bool         // the loader is following live text with -follow
+	atEnd          bool         // playback stopped at the end while following
+	queue          []string     // files to read into the document after the loading one
+	currentIdx     int
+	frame          int // index into wordFrames of the current word
+	wpm            int
+	paused         bool
+	reverse        bool   // play backward through the words
+	onFinish       string // after the last word: "pause", "quit" or "loop"
+	bell           bool   // ring the bell after the last word
+	ringing        bool   // the bell is sent with each frame
+	blurPaused     bool   // paused because the terminal lost focus
+	focusResume    bool   // resume when the terminal regains focus
+	mouse          bool   // mouse reporting is on, to turn back on after a suspend
+	noConfirm      bool   // quit or restart straight away even partway through
+	confirmQuit    bool   // asking whether to quit
+	confirmRestart bool   // waiting for restart to be pressed again
+	width          int
+	height         int
+	quit           bool
+	focusCol       int
+	help           help.Model
+	hideHelp       bool // help is cycled from short to full to hidden
+	keys           keyMap
+	progress       progress.Model
+	filepicker     filepicker.Model
+	showPicker     bool
+	pickerDir      string   // where the file picker was last left
+	recent         []string // recently opened files, newest first
+	showRecent     bool
+	recentCursor   int
+	selectedFile   string
+	windowTitle    string // last title set for the terminal window
+	fileError      string
+	urlInput       textinput.Model
+	showURLInput   bool
+	gotoInput      textinput.Model
+	showGoto       bool
+	gotoError      string
+	fetching       bool
+	fetchStart     time.Time
+	feed           *feed // feed whose entries are listed to choose from
+	feedURL        string
+	feedCursor     int
+	readingList    []listEntry // shown to choose from while showList is set
+	showList       bool
+	listCursor     int
+	listSource     string // reading list entry being read, if any
+	resumeAt       int    // where to pick it up once it has loaded
+	cancelFetch    context.CancelFunc
+	startup        tea.Cmd // run by Init, e.g. to fetch a URL given on the command line
+	spinner        spinner.Model
+	reader         bool
+	persist        bool // keep recent files, marks and reading list progress in the user's state
+	cache          bool // fetch pages through the user's page cache
+
+	rewindOnResume int
+	countdown      int
+	countdownID    int
+
+	breakEvery int // words of playback between micro-breaks, 0 for none
+	breakSecs  int
+	sinceBreak int // words played since the last break or pause
+	onBreak    int // seconds left of the current break
+	breakID    int
+
+	adaptive       bool
+	adaptiveScale  float64
+	easeSentences  bool   // slow down over the last words of each sentence
+	stopAt         string // "never", or "sentence" or "paragraph" to pause after each
+	stopped        bool   // paused by stopAt, on the last word before a stop
+	warmup         bool
+	ramp           *speedRamp
+	playStart      time.Time // zero while paused
+	playElapsed    time.Duration
+	intervalPrefix []float64 // intervalPrefix[i] is the sum of wordIntervals over words[:i]
+	pace           []paceSample
+
+	docHash    string
+	marks      map[string]int
+	pendingKey string // "m" or "'" while waiting for a mark letter, or a doubled key's first press
+	showMarks  bool
+
+	definitions map[string]definition // lookups made this session
+	defining    string                // word whose definition is shown, if any
+	defineErr   string
+	textView    *textView // full text shown with the FullText key, if any
+	statusMsg   string
+	statusMsgID int
+
+	undo     []int // positions before recent jumps
+	redo     []int
+	jumpSize int
+	count    int // pending count prefix
+	countID  int
+
+	sentences    []int // indices of words that begin a sentence
+	paragraphs   []int // indices of words that begin a paragraph
+	headings     []int // indices of words that begin a heading
+	files        []int // indices of words that begin each queued file
+	fileNames    []string
+	showSentence bool
+	contextMode  string   // "wide", "narrow", or "off" for only the focus word
+	guideMode    string   // where the focus guide is drawn, one of guideModes
+	guideChar    string   // the focus guide mark
+	showGhosts   bool     // show the previous and next words above and below
+	hidePosition bool     // leave the word count out of the status line
+	statusParts  []string // of statusSegments, those shown besides the position
+	contextWidth int      // columns of context on each side of the ORP
+
+	maxWPM      int
+	wpmStep     int
+	wpmFineStep int
+	theme       theme
+
+	stats sessionStats
+}
+
+// sessionStats tracks reading activity for the summary printed on quit
+type sessionStats struct {
+	started   time.Time
+	wordsRead int // words displayed for their full duration while playing
+	pauses    int
+	backJumps int
+	wpm       []int // effective WPM every wpmSampleEvery of playing time
+}
+
+// How often the reading speed is sampled for the summary's sparkline
+const wpmSampleEvery = 5 * time.Second
+
+// sampleWPM records the reading speed if another sample is due
+func (m *model) sampleWPM() {
+	if m.playingTime() >= time.Duration(len(m.stats.wpm)+1)*wpmSampleEvery {
+		m.stats.wpm = append(m.stats.wpm, m.effectiveWPM())
+	}
+}
+
+func initialModel(doc document, wpm int) model {
+	defaults := defaultConfig()
+
+	h := help.New()
+
+	ti := textinput.New()
+	ti.Placeholder = "https://example.com/article"
+	ti.CharLimit = 2048
+	ti.Width = 60
+
+	gi := textinput.New()
+	gi.Placeholder = "word number or N%"
+	gi.CharLimit = 20
+	gi.Width = 20
+
+	s := spinner.New(spinner.WithSpinner(spinner.Dot))
+
+	m := model{
+		wpm:        wpm,
+		paused:     true,
+		focusCol:   40,
+		help:       h,
+		keys:       keys,
+		filepicker: newPicker(""),
+		showPicker: len(doc.words) == 0,
+		urlInput:   ti,
+		gotoInput:  gi,
+		spinner:    s,
+		reader:     defaults.Reader,
+
+		definitions: make(map[string]definition),
+
+		rewindOnResume: defaults.RewindOnResume,
+		adaptiveScale:  defaults.AdaptiveScale,
+		maxWPM:         defaults.MaxWPM,
+		wpmStep:        defaults.WPMStep,
+		wpmFineStep:    defaults.WPMFineStep,
+		contextWidth:   defaults.ContextWidth,
+		contextMode:    defaults.Context,
+		guideMode:      defaults.Guide,
+		guideChar:      defaults.GuideChar,
+		stopAt:         defaults.StopAt,
+		statusParts:    defaults.Status,
+	}
+	m.keys.ReadingList.SetEnabled(false)
+	m.setJumpSize(defaults.Jump)
+	m.setTheme(themes["default"])
+	m.loadDocument(doc, "")
+	m.stats.started = time.Now()
+	return m
+}
+
+// loadDocument replaces the document and resets the reading position
+func (m *model) loadDocument(doc document, source string) {
+	m.resetDocument(doc, source)
+	m.loaded()
+}
+
+// resetDocument replaces the document, which may still be loading, and
+// resets the reading position
+func (m *model) resetDocument(doc document, source string) {
+	m.stopLoading()
+	m.doc = doc
+	m.sentences = nil
+	m.intervalPrefix = []float64{0}
+	m.extend(0)
+
+	m.currentIdx = 0
+	m.frame = 0
+	m.pause()
+	m.selectedFile = source
+	m.fileError = ""
+	m.pendingKey = ""
+	m.docHash = ""
+	m.marks = make(map[string]int)
+	m.undo, m.redo = nil, nil
+	m.pace = nil
+}
+
+// extend updates what's derived from the document for words from index from on
+func (m *model) extend(from int) {
+	m.words, m.paragraphs, m.headings = m.doc.words, m.doc.paragraphs, m.doc.headings
+	m.files, m.fileNames = m.doc.files, m.doc.fileNames
+	m.sentences = appendSentenceStarts(m.sentences, m.words, m.paragraphs, from)
+	m.sumIntervals(from)
+}
+
+// sumIntervals updates intervalPrefix for words from index from on
+func (m *model) sumIntervals(from int) {
+	// The pause after the previous last word depends on what followed it,
+	// and the easing of the last few on where their sentence ends
+	start := max(from-1, 0)
+	if m.easeSentences {
+		start = max(from-easeWords, 0)
+	}
+	m.intervalPrefix = m.intervalPrefix[:start+1]
+	for i := start; i < len(m.words); i++ {
+		m.intervalPrefix = append(m.intervalPrefix, m.intervalPrefix[i]+m.wordIntervals(i))
+	}
+}
+
+// Extra word intervals spent on the last word of a paragraph or heading
+const (
+	paragraphPause = 2.0
+	headingPause   = 4.0
+)
+
+// pauseAfter returns the extra intervals spent on the word at idx before the
+// next one: the end of a heading or paragraph gets a pause to mark it
+func (m model) pauseAfter(idx int) float64 {
+	if idx+1 >= len(m.words) {
+		return 0
+	}
+	if _, ends := slices.BinarySearch(m.paragraphs, idx+1); !ends {
+		return 0
+	}
+	if m.inHeading(idx) {
+		return headingPause
+	}
+	return paragraphPause
+}
+
+// inHeading reports whether the word at idx is part of a heading
+func (m model) inHeading(idx int) bool {
+	p := sort.SearchInts(m.paragraphs, idx+1) - 1
+	if p < 0 {
+		return false
+	}
+	_, found := slices.BinarySearch(m.headings, m.paragraphs[p])
+	return found
+}
+
+// restoreState has the reader keep its recent files, marks and reading list
+// progress in the user's state directory, as the skim command does, picking
+// up the picker's last directory and the document's saved marks
+func (m *model) restoreState() {
+	m.persist = true
+	m.keys.ReadingList.SetEnabled(true)
+	m.pickerDir = loadRecentFiles().Dir
+	m.filepicker = newPicker(m.pickerDir)
+	m.loadMarks()
+}
+
+// loadMarks restores the document's saved marks, if the reader keeps its state
+func (m *model) loadMarks() {
+	if !m.persist || m.docHash == "" {
+		return
+	}
+	if marks := loadDocState(m.docHash).Marks; marks != nil {
+		m.marks = marks
+	}
+}
+
+// saveMarks stores the document's marks, if the reader keeps its state
+func (m *model) saveMarks() error {
+	if !m.persist {
+		return nil
+	}
+	return saveDocState(m.docHash, docState{Marks: m.marks})
+}
+
+// loaded identifies the now complete document and restores its marks, and
+// the position in it when it's from the reading list
+func (m *model) loaded() {
+	m.docHash = documentHash(m.words)
+	m.loadMarks()
+	if m.resumeAt > 0 && m.selectedFile == m.listSource && len(m.words) > 0 {
+		m.currentIdx = min(m.resumeAt, len(m.words)-1)
+		m.frame = 0
+	}
+	m.resumeAt = 0
+}
+
+// startLoading replaces the document with one streamed from l, reading the
+// first chunk straight away so errors and empty text are caught up front
+func (m *model) startLoading(l chunkLoader, source string) (tea.Cmd, error) {
+	tokens, done, err := l.next()
+	if err != nil {
+		return nil, err
+	}
+	if done && len(tokens) == 0 {
+		return nil, errNoWords
+	}
+	var doc document
+	doc.add(tokens)
+	m.resetDocument(doc, source)
+	if done {
+		m.loaded()
+		return nil, nil
+	}
+	m.loader = l
+	return loadCmd(l), nil
+}
+
+// reload swaps in a new version of the document, keeping the position and
+// playback as they were as far as possible
+func (m *model) reload(doc document) {
+	old, idx, playing := m.words, m.currentIdx, !m.paused
+	m.loadDocument(doc, m.selectedFile)
+	m.currentIdx = anchorIndex(old, m.words, idx)
+	if playing {
+		// The pending tick carries on playback
+		m.play()
+	}
+}
+
+// Words from the current one on that must match for a position to carry
+// over to a changed document
+const anchorWords = 5
+
+// anchorIndex finds where the word at idx in old is in new: the nearest place
+// the words from it on appear again, or else the same index clamped to new
+func anchorIndex(old, new []string, idx int) int {
+	if idx >= len(old) {
+		return max(0, min(idx, len(new)-1))
+	}
+	seq := old[idx:min(idx+anchorWords, len(old))]
+	matches := func(i int) bool {
+		return i >= 0 && i+len(seq) <= len(new) && slices.Equal(new[i:i+len(seq)], seq)
+	}
+	for d := 0; idx-d >= 0 || idx+d < len(new); d++ {
+		if matches(idx - d) {
+			return idx - d
+		}
+		if matches(idx + d) {
+			return idx + d
+		}
+	}
+	return max(0, min(idx, len(new)-1))
+}
+
+// startQueue replaces the document with the given files read back to back
+func (m *model) startQueue(paths []string, source string) tea.Cmd {
+	m.resetDocument(document{}, source)
+	m.queue = paths
+	return m.loadNext()
+}
+
+// loadNext starts loading the next readable file in the queue, skipping
+// those that can't be opened, and finishes the document once it's empty
+func (m *model) loadNext() tea.Cmd {
+	var cmds []tea.Cmd
+	for len(m.queue) > 0 {
+		path := m.queue[0]
+		m.queue = m.queue[1:]
+		l, err := openSource(path, m.reader)
+		if err != nil {
+			cmds = append(cmds, m.flash(fmt.Sprintf("Skipped %s: %v", sourceName(path), err)))
+			continue
+		}
+		m.loader = l
+		m.doc.startFile(path)
+		m.extend(len(m.words))
+		return tea.Batch(append(cmds, loadCmd(l))...)
+	}
+	m.loader = nil
+	if len(m.words) == 0 {
+		m.fileError = fmt.Sprintf("No words found in %s", m.selectedFile)
+	}
+	m.loaded()
+	return tea.Batch(cmds...)
+}
+
+// stopLoading abandons any document still loading
+func (m *model) stopLoading() {
+	if m.loader != nil {
+		m.loader.close()
+		m.loader = nil
+	}
+	m.queue = nil
+}
+
+// chunkMsg carries the next chunk of a loading document
+type chunkMsg struct {
+	loader chunkLoader
+	tokens []token
+	done   bool
+	err    error
+}
+
+// loadCmd reads the next chunk of a document in the background
+func loadCmd(l chunkLoader) tea.Cmd {
+	return func() tea.Msg {
+		tokens, done, err := l.next()
+		return chunkMsg{loader: l, tokens: tokens, done: done, err: err}
+	}
+}
+
+// Punctuation that may trail or lead a word around sentence boundaries
+const (
+	closingQuotes = `"')]}»”’`
+	openingQuotes = `"'([{«“‘`
+)
+
+// isSentenceEnd reports whether a word ends with terminal punctuation
+func isSentenceEnd(word string) bool {
+	word = strings.TrimRight(word, closingQuotes)
+	r, _ := utf8.DecodeLastRuneInString(word)
+	return strings.ContainsRune(".?!。？！…", r)
+}
+
+// appendSentenceStarts appends the indices of words from index from on that
+// begin a sentence: the start of each paragraph, and any word following
+// terminal punctuation that doesn't start with a lowercase letter
+func appendSentenceStarts(starts []int, words []string, paragraphs []int, from int) []int {
+	p := sort.SearchInts(paragraphs, from)
+	for i := from; i < len(words); i++ {
+		for p < len(paragraphs) && paragraphs[p] < i {
+			p++
+		}
+		if i == 0 || p < len(paragraphs) && paragraphs[p] == i {
+			starts = append(starts, i)
+			continue
+		}
+		if !isSentenceEnd(words[i-1]) {
+			continue
+		}
+		r, _ := utf8.DecodeRuneInString(strings.TrimLeft(words[i], openingQuotes))
+		if !unicode.IsLower(r) {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// prevBoundary returns the last boundary before idx, or 0
+func prevBoundary(starts []int, idx int) int {
+	i := sort.SearchInts(starts, idx) - 1
+	if i < 0 {
+		return 0
+	}
+	return starts[i]
+}
+
+// nextBoundary returns the first boundary after idx, or last when there is none
+func nextBoundary(starts []int, idx, last int) int {
+	i := sort.SearchInts(starts, idx+1)
+	if i >= len(starts) {
+		return last
+	}
+	return starts[i]
+}
+
+// prevBoundaryN moves back n boundaries from idx
+func prevBoundaryN(starts []int, idx, n int) int {
+	for ; n > 0 && idx > 0; n-- {
+		idx = prevBoundary(starts, idx)
+	}
+	return idx
+}
+
+// nextBoundaryN moves forward n boundaries from idx
+func nextBoundaryN(starts []int, idx, last, n int) int {
+	for ; n > 0 && idx < last; n-- {
+		idx = nextBoundary(starts, idx, last)
+	}
+	return idx
+}
+
+// sentenceBounds returns the half-open word range of the sentence containing idx
+func (m model) sentenceBounds(idx int) (int, int) {
+	i := sort.SearchInts(m.sentences, idx+1) - 1
+	start := m.sentences[max(0, i)]
+	end := len(m.words)
+	if i+1 < len(m.sentences) {
+		end = m.sentences[i+1]
+	}
+	return start, end
+}
+
+// truncateLeft keeps the rightmost graphemes of s that fit in width cells,
+// marking the cut with an ellipsis
+func truncateLeft(s string, width int) string {
+	if uniseg.StringWidth(s) <= width {
+		return s
+	}
+	clusters := graphemes(s)
+	w := 1
+	i := len(clusters)
+	for i > 0 && w+uniseg.StringWidth(clusters[i-1]) <= width {
+		i--
+		w += uniseg.StringWidth(clusters[i])
+	}
+	return "…" + strings.Join(clusters[i:], "")
+}
+
+// truncateRight keeps the leftmost graphemes of s that fit in width cells,
+// marking the cut with an ellipsis
+func truncateRight(s string, width int) string {
+	if uniseg.StringWidth(s) <= width {
+		return s
+	}
+	clusters := graphemes(s)
+	w := 1
+	i := 0
+	for i < len(clusters) && w+uniseg.StringWidth(clusters[i]) <= width {
+		w += uniseg.StringWidth(clusters[i])
+		i++
+	}
+	return strings.Join(clusters[:i], "") + "…"
+}
+
+// ghostLine draws a word beside the current one, with its ORP on the focus
+// column
+func (m model) ghostLine(word string, style lipgloss.Style) string {
+	word = wordFrames(word)[0]
+	clusters := graphemes(word)
+	before := uniseg.StringWidth(strings.Join(clusters[:calculateORP(word)], ""))
+	word = truncateRight(word, max(0, m.width-m.focusCol+before-1))
+	return strings.Repeat(" ", max(0, m.focusCol-before)) + style.Render(word)
+}
+
+// Columns of context on each side of the ORP in narrow context mode, at most
+const narrowContext = 12
+
+// Context modes in the order the context key cycles through them
+var contextModes = []string{"wide", "narrow", "off"}
+
+// Focus guide placements: a mark above the focus letter, marks above and
+// below it, or none
+var guideModes = []string{"above", "both", "off"}
+
+// halfWidth returns the columns of context on each side of the ORP, narrowed
+// to what fits between the focus column and the edges of the screen
+func (m model) halfWidth() int {
+	w := m.contextWidth
+	if m.contextMode == "narrow" {
+		w = min(w, narrowContext)
+	}
+	return max(0, min(w, m.focusCol, m.width-m.focusCol-1))
+}
+
+// contextText returns the words around the current one, fitted to the given
+// widths on either side of the focus word.
+func (m model) contextText(beforeWidth, afterWidth int) (string, string) {
+	// Walk backward only as far as needed to fill the visible context
+	start := m.currentIdx
+	for n := 0; start > 0 && n < beforeWidth; {
+		start--
+		n += uniseg.StringWidth(m.words[start]) + 1
+	}
+	var before strings.Builder
+	for i := start; i < m.currentIdx; i++ {
+		before.WriteString(m.words[i] + " ")
+	}
+
+	var after strings.Builder
+	for i, n := m.currentIdx+1, 0; i < len(m.words) && n < afterWidth; i++ {
+		after.WriteString(" " + m.words[i])
+		n += uniseg.StringWidth(m.words[i]) + 1
+	}
+	return fitLeft(before.String(), beforeWidth), fitRight(after.String(), afterWidth)
+}
+
+// fitLeft returns the end of s that fills exactly width cells, padded on the
+// left. A wide character that would straddle the edge becomes a space.
+func fitLeft(s string, width int) string {
+	clusters := graphemes(s)
+	w, i := 0, len(clusters)
+	for i > 0 && w+uniseg.StringWidth(clusters[i-1]) <= width {
+		i--
+		w += uniseg.StringWidth(clusters[i])
+	}
+	return strings.Repeat(" ", width-w) + strings.Join(clusters[i:], "")
+}
+
+// fitRight returns the start of s that fills exactly width cells, padded on
+// the right. A wide character that would straddle the edge becomes a space.
+func fitRight(s string, width int) string {
+	clusters := graphemes(s)
+	w, i := 0, 0
+	for i < len(clusters) && w+uniseg.StringWidth(clusters[i]) <= width {
+		w += uniseg.StringWidth(clusters[i])
+		i++
+	}
+	return strings.Join(clusters[:i], "") + strings.Repeat(" ", width-w)
+}
+
+// sentenceView renders the current sentence with the current word
+// highlighted, windowed around the word when it doesn't fit in width
+func (m model) sentenceView(width int, textStyle, wordStyle lipgloss.Style) string {
+	start, end := m.sentenceBounds(m.currentIdx)
+	before := strings.Join(m.words[start:m.currentIdx], " ")
+	after := strings.Join(m.words[m.currentIdx+1:end], " ")
+	if before != "" {
+		before += " "
+	}
+	if after != "" {
+		after = " " + after
+	}
+	current := truncateRight(m.words[m.currentIdx], width)
+
+	avail := max(0, width-uniseg.StringWidth(current))
+	leftBudget := avail / 2
+	rightBudget := avail - leftBudget
+	// Give space unused on one side to the other
+	if w := uniseg.StringWidth(before); w < leftBudget {
+		rightBudget += leftBudget - w
+		leftBudget = w
+	} else if w := uniseg.StringWidth(after); w < rightBudget {
+		leftBudget += rightBudget - w
+		rightBudget = w
+	}
+
+	return textStyle.Render(truncateLeft(before, leftBudget)) +
+		wordStyle.Render(current) +
+		textStyle.Render(truncateRight(after, rightBudget))
+}
+
+// Upper bound for count prefixes
+const maxCount = 1_000_000
+
+// digitKey returns the value of a digit keypress
+func digitKey(msg tea.KeyMsg) (int, bool) {
+	if msg.Type != tea.KeyRunes || len(msg.Runes) != 1 || msg.Runes[0] < '0' || msg.Runes[0] > '9' {
+		return 0, false
+	}
+	return int(msg.Runes[0] - '0'), true
+}
+
+// How long a count prefix waits for the motion it applies to
+const countTimeout = 3 * time.Second
+
+// countOr returns the count prefix if one was typed, otherwise def
+func countOr(count, def int) int {
+	if count > 0 {
+		return count
+	}
+	return def
+}
+
+// setAdaptiveScale sets the per-grapheme adaptive timing increment and
+// recomputes the remaining-time sums that depend on it
+func (m *model) setAdaptiveScale(scale float64) {
+	m.adaptiveScale = scale
+	m.sumIntervals(0)
+}
+
+// setAdaptive turns adaptive timing on or off, recomputing the
+// remaining-time sums that depend on it
+func (m *model) setAdaptive(on bool) {
+	m.adaptive = on
+	m.sumIntervals(0)
+}
+
+// setJumpSize sets the distance for JumpBack/JumpFwd and updates their help
+func (m *model) setJumpSize(n int) {
+	m.jumpSize = n
+	m.keys.JumpBack.SetHelp(m.keys.JumpBack.Help().Key, fmt.Sprintf("-%d words", n))
+	m.keys.JumpFwd.SetHelp(m.keys.JumpFwd.Help().Key, fmt.Sprintf("+%d words", n))
+}
+
+// flash shows a transient message in the status area
+func (m *model) flash(text string) tea.Cmd {
+	m.statusMsg = text
+	m.statusMsgID++
+	id := m.statusMsgID
+	return tea.Tick(2*time.Second, func(time.Time) tea.Msg {
+		return clearStatusMsg{id: id}
+	})
+}
+
+// Typical word length, which adaptive timing shows for the base interval
+const averageWordLength = 5
+
+// wordFactor scales a word's display time by its length for adaptive timing,
+// adding scale per grapheme beyond the average length
+func wordFactor(word string, scale float64) float64 {
+	f := 1 + scale*float64(uniseg.GraphemeClusterCount(word)-averageWordLength)
+	return min(max(f, 0.5), 2.5)
+}
+
+// Lowest supported reading speed
+const minWPM = 50
+
+// clampWPM limits a speed to the supported range
+func clampWPM(wpm, maxWPM int) int {
+	return min(max(wpm, minWPM), maxWPM)
+}
+
+// play starts playback and the playing-time clock
+func (m *model) play() {
+	if m.paused {
+		m.paused = false
+		m.playStart = time.Now()
+	}
+	m.blurPaused = false
+	m.stopped = false
+}
+
+// Where playback can stop, in the order the stop key cycles through them
+var stopModes = []string{"never", "sentence", "paragraph"}
+
+// stopsAfter reports whether playback stops after the word at idx, the last
+// of its sentence or paragraph as set by stopAt
+func (m model) stopsAfter(idx int) bool {
+	var starts []int
+	switch m.stopAt {
+	case "sentence":
+		starts = m.sentences
+	case "paragraph":
+		starts = m.paragraphs
+	default:
+		return false
+	}
+	_, found := slices.BinarySearch(starts, idx+1)
+	return found
+}
+
+// pause stops playback, cancelling any pending resume countdown
+func (m *model) pause() {
+	if !m.paused {
+		m.playElapsed += time.Since(m.playStart)
+		m.playStart = time.Time{}
+	}
+	m.paused = true
+	m.countdown = 0
+	m.onBreak = 0
+}
+
+// playingTime returns the total time spent playing, excluding pauses
+func (m model) playingTime() time.Duration {
+	if m.playStart.IsZero() {
+		return m.playElapsed
+	}
+	return m.playElapsed + time.Since(m.playStart)
+}
+
+// jumpTo moves to idx, clamped to the document, counting backward jumps and
+// remembering where it came from if it skips any words
+func (m *model) jumpTo(idx int) {
+	idx = max(0, min(idx, len(m.words)-1))
+	if idx < m.currentIdx {
+		m.stats.backJumps++
+	}
+	if idx < m.currentIdx-1 || idx > m.currentIdx+1 {
+		m.remember()
+	}
+	if max(idx-m.currentIdx, m.currentIdx-idx) > maxPaceJump {
+		// Moving somewhere else entirely says nothing about reading pace
+		m.pace = nil
+	}
+	m.currentIdx = idx
+	m.frame = 0
+}
+
+// Jumps that can be undone
+const maxUndo = 20
+
+// remember records the current position so a jump from it can be undone
+func (m *model) remember() {
+	m.undo = append(m.undo, m.currentIdx)
+	if len(m.undo) > maxUndo {
+		m.undo = m.undo[1:]
+	}
+	m.redo = nil
+}
+
+// undoJump returns to the position before the last jump, keeping the current
+// one to redo; redoJump does the reverse
+func (m *model) undoJump() tea.Cmd {
+	if len(m.undo) == 0 {
+		return m.flash("Nothing to undo")
+	}
+	m.redo = append(m.redo, m.currentIdx)
+	m.currentIdx, m.undo = min(m.undo[len(m.undo)-1], len(m.words)-1), m.undo[:len(m.undo)-1]
+	m.frame = 0
+	return m.flash("Restored position " + formatCount(m.currentIdx+1))
+}
+
+func (m *model) redoJump() tea.Cmd {
+	if len(m.redo) == 0 {
+		return m.flash("Nothing to redo")
+	}
+	m.undo = append(m.undo, m.currentIdx)
+	m.currentIdx, m.redo = min(m.redo[len(m.redo)-1], len(m.words)-1), m.redo[:len(m.redo)-1]
+	m.frame = 0
+	return m.flash("Restored position " + formatCount(m.currentIdx+1))
+}
+
+// togglePlay pauses or resumes playback, rewinding and counting down
+// before resuming mid-document unless the rewind is 0
+func (m *model) togglePlay() tea.Cmd {
+	if m.countdown > 0 {
+		// Cancel a pending resume
+		m.countdown = 0
+		return nil
+	}
+	if !m.paused {
+		m.pause()
+		m.stats.pauses++
+		m.sinceBreak = 0
+		return nil
+	}
+	if m.stopped && m.stopsAfter(m.currentIdx) {
+		// Carry straight on with the next sentence or paragraph
+		m.currentIdx = min(m.currentIdx+1, len(m.words)-1)
+		m.frame = 0
+		m.play()
+		return tickCmd(m.wordDelay(m.currentIdx))
+	}
+	if m.currentIdx == 0 || m.rewindOnResume == 0 {
+		m.play()
+		return tickCmd(m.wordDelay(m.currentIdx))
+	}
+	if m.reverse {
+		// Rewinding in reverse means going forward to reread
+		m.currentIdx = min(len(m.words)-1, m.currentIdx+m.rewindOnResume)
+	} else {
+		m.currentIdx = max(0, m.currentIdx-m.rewindOnResume)
+	}
+	m.frame = 0
+	m.countdown = countdownSteps
+	m.countdownID++
+	return countdownCmd(m.countdownID)
+}
+
+// finish acts on reaching the last word as set by -on-finish
+func (m *model) finish() tea.Cmd {
+	switch m.onFinish {
+	case "quit":
+		m.quit = true
+		return tea.Quit
+	case "loop":
+		m.currentIdx = 0
+		m.frame = 0
+		return tickCmd(m.wordDelay(m.currentIdx))
+	}
+	m.pause()
+	return nil
+}
+
+// ringBell rings the terminal bell if enabled. The bell goes out with the
+// next frames, so it reaches whatever the program renders to.
+func (m *model) ringBell() tea.Cmd {
+	if !m.bell {
+		return nil
+	}
+	m.ringing = true
+	return tea.Tick(bellTime, func(time.Time) tea.Msg {
+		return bellDoneMsg{}
+	})
+}
+
+// adjustWPM changes the target speed, ending any ramp in progress, and
+// flashes the change so it registers even when the status line is busy
+func (m *model) adjustWPM(delta int) tea.Cmd {
+	m.stopRamp()
+	old := m.wpm
+	m.wpm = clampWPM(m.wpm+delta, m.maxWPM)
+	if m.wpm == old {
+		return m.flash(fmt.Sprintf("Speed limit reached (%d WPM)", m.wpm))
+	}
+	return m.flash(fmt.Sprintf("%+d WPM → %d", m.wpm-old, m.wpm))
+}
+
+// parseGoto reads a 1-based word number or a percentage such as "50%" into
+// an index in a document of n words, clamped to the document
+func parseGoto(s string, n int) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errors.New("Type a word number or a percentage")
+	}
+	if pct, ok := strings.CutSuffix(s, "%"); ok {
+		p, err := strconv.ParseFloat(strings.TrimSpace(pct), 64)
+		if err != nil || p < 0 || p > 100 {
+			return 0, fmt.Errorf("%q is not a percentage from 0 to 100", s)
+		}
+		return max(0, min(int(p*float64(n)/100), n-1)), nil
+	}
+	w, err := strconv.Atoi(s)
+	if err != nil || w < 1 {
+		return 0, fmt.Errorf("%q is not a word number or a percentage", s)
+	}
+	return min(w, n) - 1, nil
+}
+
+// seek pauses and moves to a percentage of the way through the document
+func (m *model) seek(pct int) {
+	m.pause()
+	m.jumpTo(pct * len(m.words) / 100)
+}
+
+// frames returns the frames of the current word
+func (m model) frames() []string {
+	if m.currentIdx >= len(m.words) {
+		return nil
+	}
+	return wordFrames(m.words[m.currentIdx])
+}
+
+// summary describes the session's reading, or returns "" if nothing was read
+func (m model) summary() string {
+	if m.stats.wordsRead == 0 {
+		return ""
+	}
+	elapsed := m.playingTime()
+	paused := time.Since(m.stats.started) - elapsed
+	return fmt.Sprintf("read %s of %s words in %s (%s paused) — effective %d WPM, %s, %s",
+		formatCount(m.stats.wordsRead), formatCount(len(m.words)), elapsed.Round(time.Second),
+		paused.Round(time.Second), averageWPM(m.stats.wordsRead, elapsed),
+		plural(m.stats.pauses, "pause", "pauses"), plural(m.stats.backJumps, "jump back", "jumps back"))
+}
+
+// speedLine draws the session's reading speed over time as a sparkline
+// within width columns, or returns "" with too few samples to show a trend
+func (m model) speedLine(width int) string {
+	samples := m.stats.wpm
+	if len(samples) < 2 {
+		return ""
+	}
+	label := fmt.Sprintf("WPM %d–%d ", slices.Min(samples), slices.Max(samples))
+	if slices.Min(samples) == slices.Max(samples) {
+		label = fmt.Sprintf("WPM %d ", samples[0])
+	}
+	return label + sparkline(samples, width-uniseg.StringWidth(label))
+}
+
+// Bars for sparklines, lowest first
+const sparkBars = "▁▂▃▄▅▆▇█"
+
+// sparkline draws values as bars scaled between their minimum and maximum,
+// averaging neighbouring values to fit within width columns
+func sparkline(values []int, width int) string {
+	if width <= 0 || len(values) == 0 {
+		return ""
+	}
+	if len(values) > width {
+		buckets := make([]int, width)
+		for i := range buckets {
+			from, to := i*len(values)/width, (i+1)*len(values)/width
+			sum := 0
+			for _, v := range values[from:to] {
+				sum += v
+			}
+			buckets[i] = sum / (to - from)
+		}
+		values = buckets
+	}
+	bars := []rune(sparkBars)
+	lo, hi := slices.Min(values), slices.Max(values)
+	var b strings.Builder
+	for _, v := range values {
+		level := len(bars) / 2
+		if hi > lo {
+			level = (v - lo) * (len(bars) - 1) / (hi - lo)
+		}
+		b.WriteRune(bars[level])
+	}
+	return b.String()
+}
+
+// averageWPM returns the reading speed achieved over a period of reading
+func averageWPM(words int, elapsed time.Duration) int {
+	if elapsed <= 0 {
+		return 0
+	}
+	return int(float64(words) / elapsed.Minutes())
+}
+
+// historyEntry is one session in the reading history log
+type historyEntry struct {
+	Source   string    `json:"source,omitempty"`
+	Time     time.Time `json:"time"`
+	Words    int       `json:"words"`
+	Duration float64   `json:"duration"` // seconds spent playing
+}
+
+// historyEntry records the session for the reading history log
+func (m model) historyEntry() historyEntry {
+	return historyEntry{
+		Source:   redactURL(m.selectedFile),
+		Time:     m.stats.started,
+		Words:    m.stats.wordsRead,
+		Duration: m.playingTime().Seconds(),
+	}
+}
+
+// dataDir returns the directory for skim's long-lived data
+func dataDir() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "skim"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "skim"), nil
+}
+
+// historyPath returns the location of the reading history log
+func historyPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+// appendHistory adds a session to the reading history log
+func appendHistory(entry historyEntry) error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(entry); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readHistory returns every session in the reading history log, skipping
+// lines that can't be parsed
+func readHistory() ([]historyEntry, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry historyEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// listEntry is one item on the reading list
+type listEntry struct {
+	Source   string    `json:"source"` // URL or absolute path
+	Added    time.Time `json:"added"`
+	Title    string    `json:"title,omitempty"`
+	Position int       `json:"position,omitempty"` // word reading last got to
+	Percent  int       `json:"percent,omitempty"`  // how far through that was
+	Done     bool      `json:"done,omitempty"`
+}
+
+// name is how an entry is shown in the reading list
+func (e listEntry) name() string {
+	return cmp.Or(e.Title, sourceName(e.Source))
+}
+
+// readingListPath returns the location of the reading list
+func readingListPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "queue"), nil
+}
+
+// loadReadingList returns the entries on the reading list, skipping lines
+// that can't be parsed
+func loadReadingList() ([]listEntry, error) {
+	path, err := readingListPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []listEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry listEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.Source != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// saveReadingList replaces the reading list with entries
+func saveReadingList(entries []listEntry) error {
+	path, err := readingListPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// addToReadingList adds URLs and files to the end of the reading list,
+// reporting each to w
+func addToReadingList(w io.Writer, sources []string) error {
+	entries, err := loadReadingList()
+	if err != nil {
+		return err
+	}
+	for _, src := range sources {
+		if !isURL(src) {
+			info, err := os.Stat(src)
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return fmt.Errorf("%s is not a file", src)
+			}
+			if src, err = filepath.Abs(src); err != nil {
+				return err
+			}
+		}
+		if slices.ContainsFunc(entries, func(e listEntry) bool { return e.Source == src && !e.Done }) {
+			fmt.Fprintf(w, "Already on the reading list: %s\n", sourceName(src))
+			continue
+		}
+		entries = append(entries, listEntry{Source: src, Added: time.Now()})
+		fmt.Fprintf(w, "Added to the reading list: %s\n", sourceName(src))
+	}
+	return saveReadingList(entries)
+}
+
+// printStats writes reading totals for today, the last week and all time
+func printStats(w io.Writer, entries []historyEntry, now time.Time) {
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No reading history yet")
+		return
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	periods := []struct {
+		label string
+		since time.Time
+	}{
+		{"today", today},
+		{"last 7 days", today.AddDate(0, 0, -6)},
+		{"all time", time.Time{}},
+	}
+	for _, p := range periods {
+		var words, sessions int
+		var elapsed time.Duration
+		for _, e := range entries {
+			if e.Time.Before(p.since) {
+				continue
+			}
+			words += e.Words
+			elapsed += time.Duration(e.Duration * float64(time.Second))
+			sessions++
+		}
+		fmt.Fprintf(w, "%-12s %10s words  %9s  %4d WPM  %s\n", p.label, formatCount(words),
+			elapsed.Round(time.Second), averageWPM(words, elapsed), plural(sessions, "session", "sessions"))
+	}
+}
+
+// fitSegments joins status line segments, dropping those at the end that
+// would make the line wider than width so it never wraps
+func fitSegments(segments []string, width int) string {
+	var status string
+	for i, s := range segments {
+		next := s
+		if i > 0 {
+			next = status + " │ " + s
+		}
+		if uniseg.StringWidth(next) > width {
+			if i == 0 {
+				return truncateRight(s, width)
+			}
+			break
+		}
+		status = next
+	}
+	return status
+}
+
+// Segments of the status line that can be chosen with -status, in the order
+// they're shown
+var statusSegments = []string{"wpm", "remaining", "elapsed", "position"}
+
+// statusShows reports whether the named status segment is shown
+func (m model) statusShows(name string) bool {
+	return slices.Contains(m.statusParts, name)
+}
+
+// formatCount formats n with thousands separators
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// plural formats a count with the singular or plural form of its noun
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
+
+// speedRamp linearly increases WPM from one speed to another over playing time
+type speedRamp struct {
+	from, to int
+	over     time.Duration
+}
+
+// parseRamp parses a ramp specification of the form FROM:TO:DURATION
+func parseRamp(spec string, maxWPM int) (speedRamp, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 {
+		return speedRamp{}, fmt.Errorf("expected FROM:TO:DURATION, e.g. 300:600:60s")
+	}
+	from, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return speedRamp{}, fmt.Errorf("invalid start WPM %q", parts[0])
+	}
+	to, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return speedRamp{}, fmt.Errorf("invalid target WPM %q", parts[1])
+	}
+	over, err := time.ParseDuration(parts[2])
+	if err != nil || over <= 0 {
+		return speedRamp{}, fmt.Errorf("invalid duration %q", parts[2])
+	}
+	return speedRamp{from: clampWPM(from, maxWPM), to: clampWPM(to, maxWPM), over: over}, nil
+}
+
+// ramping reports whether a speed ramp is still in progress
+func (m model) ramping() bool {
+	return m.ramp != nil && m.playingTime() < m.ramp.over
+}
+
+// stopRamp cancels the speed ramp, locking the current effective speed
+func (m *model) stopRamp() {
+	if m.ramping() {
+		m.wpm = m.effectiveWPM()
+	}
+	m.ramp = nil
+}
+
+// Warm-up starts this many WPM below the target and ramps up over warmupWords
+const (
+	warmupOffset = 200
+	warmupWords  = 50
+)
+
+// warmingUp reports whether playback is still ramping up to the target WPM
+func (m model) warmingUp() bool {
+	return m.warmup && m.currentIdx < warmupWords
+}
+
+// effectiveWPM returns the speed for the current position, accounting for warm-up
+func (m model) effectiveWPM() int {
+	return m.speedAt(m.currentIdx, m.playingTime())
+}
+
+// speedAt returns the speed for the word at idx after elapsed playing time,
+// accounting for any ramp or warm-up
+func (m model) speedAt(idx int, elapsed time.Duration) int {
+	if m.ramp != nil && elapsed < m.ramp.over {
+		return m.ramp.from + int(float64(m.ramp.to-m.ramp.from)*float64(elapsed)/float64(m.ramp.over))
+	}
+	if !m.warmup || idx >= warmupWords {
+		return m.wpm
+	}
+	start := max(minWPM, m.wpm-warmupOffset)
+	return start + (m.wpm-start)*idx/warmupWords
+}
+
+// speedChanging reports whether a ramp or warm-up still sets the speed for
+// the word at idx after elapsed playing time
+func (m model) speedChanging(idx int, elapsed time.Duration) bool {
+	return m.ramp != nil && elapsed < m.ramp.over || m.warmup && idx < warmupWords
+}
+
+// frameIntervals returns how many word intervals each frame of the word at
+// idx is shown for, scaled by its length with adaptive timing and eased
+// towards the end of a sentence
+func (m model) frameIntervals(idx int) float64 {
+	f := m.sentenceEase(idx)
+	if m.adaptive {
+		f *= wordFactor(m.words[idx], m.adaptiveScale)
+	}
+	return f
+}
+
+// With eased sentence ends, the last easeWords words of a sentence slow down
+// step by step, the final one taking easeSlowdown longer than usual
+const (
+	easeWords    = 3
+	easeSlowdown = 0.3
+)
+
+// sentenceEase returns the slowdown for the word at idx near the end of a
+// sentence, or 1 away from one
+func (m model) sentenceEase(idx int) float64 {
+	if !m.easeSentences {
+		return 1
+	}
+	_, end := m.sentenceBounds(idx)
+	left := end - idx
+	if left > easeWords || !isSentenceEnd(m.words[end-1]) {
+		return 1
+	}
+	return 1 + easeSlowdown*float64(easeWords+1-left)/easeWords
+}
+
+// wordIntervals returns how many word intervals the word at idx takes in all:
+// each of its frames, then the pause after it
+func (m model) wordIntervals(idx int) float64 {
+	return float64(len(wordFrames(m.words[idx])))*m.frameIntervals(idx) + m.pauseAfter(idx)
+}
+
+// wordDuration returns how long the word at idx takes to read at wpm. It's the
+// one measure of a word's time, for playback and estimates alike.
+func (m model) wordDuration(idx, wpm int) time.Duration {
+	return time.Duration(float64(time.Minute/time.Duration(wpm)) * m.wordIntervals(idx))
+}
+
+// wordDelay returns how long the current frame of the word at idx stays on
+// screen, or its last frame for a word that isn't current
+func (m model) wordDelay(idx int) time.Duration {
+	frame := math.MaxInt
+	if idx == m.currentIdx {
+		frame = m.frame
+	}
+	return m.frameDelay(idx, frame, m.effectiveWPM())
+}
+
+// frameDelay returns how long a frame of the word at idx stays on screen at
+// wpm. The last frame takes whatever is left of the word's duration, which
+// includes the pause after it.
+func (m model) frameDelay(idx, frame, wpm int) time.Duration {
+	interval := time.Minute / time.Duration(wpm)
+	if idx < 0 || idx >= len(m.words) {
+		return interval
+	}
+	d := time.Duration(float64(interval) * m.frameIntervals(idx))
+	frames := len(wordFrames(m.words[idx]))
+	if frame < frames-1 {
+		return d
+	}
+	return m.wordDuration(idx, wpm) - time.Duration(frames-1)*d
+}
+
+// paceSample is where reading had got to after some playing time
+type paceSample struct {
+	at  time.Duration
+	idx int
+}
+
+// Reading pace is measured over the last paceWindow of playing time, once
+// there's at least paceMinimum of it. Jumps further than maxPaceJump words
+// start the measurement again.
+const (
+	paceWindow  = 3 * time.Minute
+	paceMinimum = 30 * time.Second
+	maxPaceJump = 100
+)
+
+// samplePace records the reading position for measuring pace
+func (m *model) samplePace() {
+	now := m.playingTime()
+	m.pace = append(m.pace, paceSample{at: now, idx: m.currentIdx})
+	i := 0
+	for i < len(m.pace)-1 && now-m.pace[i+1].at >= paceWindow {
+		i++
+	}
+	m.pace = m.pace[i:]
+}
+
+// paceRemaining estimates how long the words after the current one will
+// take at the pace actually read lately, rewinds and all. It reports false
+// until there's enough reading to go on.
+func (m model) paceRemaining() (time.Duration, bool) {
+	if len(m.pace) < 2 {
+		return 0, false
+	}
+	first, last := m.pace[0], m.pace[len(m.pace)-1]
+	elapsed, advanced := last.at-first.at, last.idx-first.idx
+	if elapsed < paceMinimum || advanced <= 0 {
+		return 0, false
+	}
+	perWord := elapsed / time.Duration(advanced)
+	return perWord * time.Duration(len(m.words)-m.currentIdx-1), true
+}
+
+// remainingText describes the time left, at the pace read lately where
+// known, along with the estimate at the set speed when the two differ by
+// more than paceDivergence
+func (m model) remainingText() string {
+	nominal := m.timeRemaining()
+	actual, ok := m.paceRemaining()
+	if !ok {
+		return "~" + formatDuration(nominal) + " remaining"
+	}
+	text := "~" + formatDuration(actual) + " remaining"
+	if diff := max(actual-nominal, nominal-actual); float64(diff) > paceDivergence*float64(nominal) {
+		text += " (nominal " + formatDuration(nominal) + ")"
+	}
+	return text
+}
+
+// Fraction by which the paced and nominal estimates must differ for both to
+// be shown
+const paceDivergence = 0.15
+
+// timeRemaining estimates how long the words after the current one will take
+func (m model) timeRemaining() time.Duration {
+	// While a ramp or warm-up sets the speed, and to the end of any word
+	// begun, frames are timed one at a time as playback will time them
+	var total time.Duration
+	elapsed := m.playingTime()
+	idx, frame := m.currentIdx, m.frame
+	for idx < len(m.words) && (frame > 0 || m.speedChanging(idx, elapsed)) {
+		d := m.frameDelay(idx, frame, m.speedAt(idx, elapsed))
+		elapsed += d
+		if idx > m.currentIdx {
+			total += d
+		}
+		if frame++; frame == len(wordFrames(m.words[idx])) {
+			idx, frame = idx+1, 0
+		}
+	}
+	// The rest are read at the target speed
+	idx = min(max(idx, m.currentIdx+1), len(m.words))
+	interval := time.Minute / time.Duration(m.wpm)
+	return total + time.Duration(float64(interval)*(m.intervalPrefix[len(m.words)]-m.intervalPrefix[idx]))
+}
+
+// docState is the per-document state persisted between sessions
+type docState struct {
+	Marks map[string]int `json:"marks,omitempty"`
+}
+
+// stateDir returns the directory holding skim's persistent state
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "skim"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "skim"), nil
+}
+
+// documentHash identifies a document by its words, independent of its source
+func documentHash(words []string) string {
+	h := sha256.New()
+	for _, w := range words {
+		io.WriteString(h, w)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func docStatePath(hash string) (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "docs", hash+".json"), nil
+}
+
+// loadDocState reads the saved state for a document, returning an empty
+// state when none exists
+func loadDocState(hash string) docState {
+	var state docState
+	path, err := docStatePath(hash)
+	if err != nil {
+		return state
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return state
+	}
+	json.Unmarshal(data, &state)
+	return state
+}
+
+// saveDocState writes the state for a document
+func saveDocState(hash string, state docState) error {
+	path, err := docStatePath(hash)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Most words of a heading used to title a document
+const maxTitleWords = 12
+
+// docTitle names what is being read: the page title or first heading, and
+// where the document came from
+func (m model) docTitle() string {
+	if len(m.words) == 0 {
+		return ""
+	}
+	var source string
+	if m.selectedFile != "" {
+		source = sourceName(m.selectedFile)
+	}
+	title := m.title()
+	if title == "" || title == source {
+		return source
+	}
+	if source == "" {
+		return title
+	}
+	return title + " — " + source
+}
+
+// title returns the page title or else the first heading, if there is one
+func (m model) title() string {
+	if m.doc.title != "" || len(m.headings) == 0 {
+		return m.doc.title
+	}
+	start := m.headings[0]
+	end := min(nextBoundary(m.paragraphs, start, len(m.words)), start+maxTitleWords)
+	return strings.Join(m.words[start:end], " ")
+}
+
+// snippet returns a few words around idx for previews
+func (m model) snippet(idx int) string {
+	start := max(0, idx-3)
+	end := min(len(m.words), idx+4)
+	return strings.Join(m.words[start:end], " ")
+}
+
+func (m model) Init() tea.Cmd {
+	return tea.Batch(tickCmd(m.wordDelay(m.currentIdx)), tea.EnterAltScreen, m.filepicker.Init(), m.startup)
+}
+
+// Recently opened files kept for the recent files list
+const maxRecentFiles = 10
+
+// recentFiles is the recent files list and the picker's last directory,
+// persisted between sessions
+type recentFiles struct {
+	Dir   string   `json:"dir,omitempty"`
+	Files []string `json:"files,omitempty"`
+}
+
+func recentFilesPath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "recent.json"), nil
+}
+
+// loadRecentFiles reads the recent files list, leaving out files that no
+// longer exist
+func loadRecentFiles() recentFiles {
+	var r recentFiles
+	path, err := recentFilesPath()
+	if err != nil {
+		return r
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return r
+	}
+	json.Unmarshal(data, &r)
+	r.Files = slices.DeleteFunc(r.Files, func(f string) bool {
+		info, err := os.Stat(f)
+		return err != nil || !info.Mode().IsRegular()
+	})
+	return r
+}
+
+// saveRecentFiles writes the recent files list
+func saveRecentFiles(r recentFiles) error {
+	path, err := recentFilesPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// newPicker returns a file picker showing dir, or the working directory if
+// dir is unset or gone
+func newPicker(dir string) filepicker.Model {
+	fp := filepicker.New()
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir, _ = os.Getwd()
+	}
+	fp.CurrentDirectory = dir
+	fp.ShowHidden = false
+	fp.KeyMap = pickerKeys
+	fp.AllowedTypes = textFileExtensions
+	return fp
+}
+
+// openPicker pauses and offers the recently opened files, or the file picker
+// where it was last left if there are none
+func (m *model) openPicker() tea.Cmd {
+	m.pause()
+	if m.persist {
+		m.recent = loadRecentFiles().Files
+	}
+	if len(m.recent) > 0 {
+		m.showRecent = true
+		m.recentCursor = 0
+		return nil
+	}
+	return m.browse()
+}
+
+// browse shows the file picker in the directory it was last left in
+func (m *model) browse() tea.Cmd {
+	m.showRecent = false
+	m.showPicker = true
+	m.filepicker = newPicker(m.pickerDir)
+	if m.height > 0 {
+		m.filepicker.SetHeight(m.height - 15)
+	}
+	return m.filepicker.Init()
+}
+
+// openFile starts reading a file chosen from the picker or the recent files,
+// and records it as the most recent
+func (m *model) openFile(path string) tea.Cmd {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	l, err := openTextFile(path)
+	var cmd tea.Cmd
+	if err == nil {
+		cmd, err = m.startLoading(l, path)
+	}
+	if err != nil {
+		m.fileError = fmt.Sprintf("Error reading file: %v", err)
+		return nil
+	}
+	m.pickerDir = filepath.Dir(path)
+	m.recent = slices.DeleteFunc(m.recent, func(f string) bool { return f == path })
+	m.recent = slices.Insert(m.recent, 0, path)
+	m.recent = m.recent[:min(len(m.recent), maxRecentFiles)]
+	if !m.persist {
+		return cmd
+	}
+	if err := saveRecentFiles(recentFiles{Dir: m.pickerDir, Files: m.recent}); err != nil {
+		return tea.Batch(cmd, m.flash(fmt.Sprintf("Recent files not saved: %v", err)))
+	}
+	return cmd
+}
+
+// startFetch fetches urlStr in the background, replacing any fetch in progress
+func (m *model) startFetch(urlStr string) tea.Cmd {
+	m.stopFetch()
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancelFetch = cancel
+	m.fetching = true
+	m.fetchStart = time.Now()
+	m.fileError = ""
+	return tea.Batch(m.spinner.Tick, fetchCmd(ctx, urlStr, m.reader, m.cache))
+}
+
+// openEntry reads a feed entry, fetching the full article from its link
+// when the feed only carries a summary
+func (m *model) openEntry(e feedEntry) tea.Cmd {
+	doc := entryDocument(e)
+	if len(doc.words) >= feedMinWords || e.link == "" {
+		if len(doc.words) == 0 {
+			return m.flash("Entry has no text")
+		}
+		m.feed = nil
+		m.loadDocument(doc, cmp.Or(e.link, m.feedURL))
+		return nil
+	}
+	m.feed = nil
+	m.showURLInput = true
+	m.urlInput.SetValue(e.link)
+	return tea.Batch(m.urlInput.Focus(), m.startFetch(e.link))
+}
+
+// listTitleMsg carries the title of a page on the reading list
+type listTitleMsg struct {
+	source, title string
+}
+
+// listTitleCmd fetches the title of a page on the reading list, which also
+// caches the page for reading later
+func listTitleCmd(source string) tea.Cmd {
+	return func() tea.Msg {
+		page, err := fetchPage(context.Background(), source)
+		if err != nil {
+			return listTitleMsg{source: source}
+		}
+		return listTitleMsg{source: source, title: page.title()}
+	}
+}
+
+// openReadingList pauses and shows the reading list, fetching the titles of
+// pages that don't have one yet
+func (m *model) openReadingList() tea.Cmd {
+	entries, err := loadReadingList()
+	if err != nil {
+		return m.flash(fmt.Sprintf("Error reading the reading list: %v", err))
+	}
+	m.pause()
+	m.readingList = entries
+	m.showList = true
+	m.listCursor = 0
+	var cmds []tea.Cmd
+	for i, e := range entries {
+		if e.Title == "" && isURL(e.Source) {
+			cmds = append(cmds, listTitleCmd(e.Source))
+		}
+		if e.Source == m.listSource {
+			m.listCursor = i
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
+// openListEntry starts reading an entry from the reading list where it was
+// left, or from the start once it's been finished
+func (m *model) openListEntry(e listEntry) tea.Cmd {
+	m.showList = false
+	m.listSource = e.Source
+	m.resumeAt = e.Position
+	if e.Done {
+		m.resumeAt = 0
+	}
+	if isURL(e.Source) {
+		m.showURLInput = true
+		m.urlInput.SetValue(e.Source)
+		return tea.Batch(m.urlInput.Focus(), m.startFetch(e.Source))
+	}
+	l, err := openTextFile(e.Source)
+	var cmd tea.Cmd
+	if err == nil {
+		cmd, err = m.startLoading(l, e.Source)
+	}
+	if err != nil {
+		m.showList = true
+		return m.flash(fmt.Sprintf("Error reading %s: %v", sourceName(e.Source), err))
+	}
+	return cmd
+}
+
+// saveProgress records how far the reading list entry being read has got,
+// marking it done when it's been finished
+func (m *model) saveProgress(done bool) error {
+	if m.listSource == "" || m.selectedFile != m.listSource || len(m.words) == 0 {
+		return nil
+	}
+	entries, err := loadReadingList()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(entries, func(e listEntry) bool { return e.Source == m.listSource })
+	if i < 0 {
+		// Removed while it was being read
+		return nil
+	}
+	e := &entries[i]
+	e.Position = m.currentIdx
+	e.Percent = (m.currentIdx + 1) * 100 / len(m.words)
+	e.Done = e.Done || done
+	e.Title = cmp.Or(e.Title, m.title())
+	m.readingList = entries
+	return saveReadingList(entries)
+}
+
+// progressCmd saves the reading list progress, flashing any error
+func (m *model) progressCmd(done bool) tea.Cmd {
+	if err := m.saveProgress(done); err != nil {
+		return m.flash(fmt.Sprintf("Error saving the reading list: %v", err))
+	}
+	return nil
+}
+
+// stopFetch cancels any fetch in progress
+func (m *model) stopFetch() {
+	if m.cancelFetch != nil {
+		m.cancelFetch()
+		m.cancelFetch = nil
+	}
+	m.fetching = false
+}
+
+// Number of seconds counted down before playback resumes
+const countdownSteps = 3
+
+func breakCmd(id int) tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return breakMsg{id: id}
+	})
+}
+
+// nextWord schedules the word just moved to, or starts a micro-break when
+// one is due
+func (m *model) nextWord() tea.Cmd {
+	m.sinceBreak++
+	if m.breakEvery == 0 || m.sinceBreak < m.breakEvery || m.overlayShown() {
+		return tickCmd(m.wordDelay(m.currentIdx))
+	}
+	m.pause()
+	m.sinceBreak = 0
+	m.onBreak = max(1, m.breakSecs)
+	m.breakID++
+	return breakCmd(m.breakID)
+}
+
+// typing reports whether a key sequence or text entry is under way
+func (m model) typing() bool {
+	return m.showPicker || m.showURLInput || m.showGoto || m.confirmQuit || m.pendingKey != "" || m.count > 0
+}
+
+// overlayShown reports whether something is drawn over the reader
+func (m model) overlayShown() bool {
+	return m.showPicker || m.showRecent || m.showURLInput || m.showGoto || m.feed != nil || m.showList || m.textView != nil || m.defining != "" || m.showMarks
+}
+
+func countdownCmd(id int) tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return countdownMsg{id: id}
+	})
+}
+
+func tickCmd(delay time.Duration) tea.Cmd {
+	return tea.Tick(delay, func(t time.Time) tea.Msg {
+		return tickMsg(t)
+	})
+}
+
+// Update handles a message, keeping the terminal's title in step with the
+// document being read and applying a held reload once typing is done
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	next, cmd := m.update(msg)
+	nm := next.(model)
+	if nm.heldReload != nil && !nm.typing() {
+		doc := *nm.heldReload
+		nm.heldReload = nil
+		if nm.watcher != nil && nm.selectedFile == nm.watcher.path {
+			nm.reload(doc)
+			cmd = tea.Batch(cmd, nm.flash("Reloaded"))
+		}
+	}
+	if title := cmp.Or(nm.docTitle(), "skim"); title != nm.windowTitle {
+		nm.windowTitle = title
+		cmd = tea.Batch(cmd, tea.SetWindowTitle(title))
+	}
+	return nm, cmd
+}
+
+func (m model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.WindowSizeMsg); ok {
+		m.width = msg.Width
+		m.height = msg.Height
+		m.focusCol = msg.Width / 2
+		m.help.Width = msg.Width
+		m.filepicker.SetHeight(max(1, min(20, msg.Height-15)))
+		m.urlInput.Width = max(10, min(60, msg.Width-10))
+		m.progress.Width = min(40, msg.Width-4)
+		if m.tooSmall() {
+			// Words can't be followed on a screen that can't show them
+			m.pause()
+		}
+	}
+
+	// Suspending works from any view, and leaves playback paused on return
+	if msg, ok := msg.(tea.KeyMsg); ok && key.Matches(msg, m.keys.Suspend) {
+		m.pause()
+		return m, tea.Suspend
+	}
+	if _, ok := msg.(tea.ResumeMsg); ok {
+		// The shell may have retitled the window, and mouse reporting was
+		// turned off along with the alt screen
+		m.windowTitle = ""
+		if m.mouse {
+			return m, tea.EnableMouseCellMotion
+		}
+		return m, nil
+	}
+
+	if msg, ok := msg.(chunkMsg); ok {
+		if msg.loader != m.loader {
+			// Loading was abandoned for another document
+			return m, nil
+		}
+		if msg.err != nil && len(m.files) > 0 {
+			// One bad file shouldn't end a queue
+			name := sourceName(m.fileNames[len(m.fileNames)-1])
+			return m, tea.Batch(m.flash(fmt.Sprintf("Skipped %s: %v", name, msg.err)), m.loadNext())
+		}
+		if msg.err != nil {
+			m.loader = nil
+			m.fileError = fmt.Sprintf("Error reading %s: %v", m.selectedFile, msg.err)
+			m.loaded()
+			return m, nil
+		}
+		from := len(m.words)
+		m.doc.add(msg.tokens)
+		m.extend(from)
+		if m.atEnd && m.paused && m.currentIdx == from-1 && len(m.words) > from {
+			// Carry on with the words that just arrived
+			m.atEnd = false
+			m.play()
+			m.jumpTo(from)
+			return m, tea.Batch(loadCmd(m.loader), tickCmd(m.wordDelay(m.currentIdx)))
+		}
+		if msg.done && len(m.files) > 0 {
+			return m, m.loadNext()
+		}
+		if msg.done {
+			m.loader = nil
+			m.loaded()
+			return m, nil
+		}
+		return m, loadCmd(m.loader)
+	}
+
+	if msg, ok := msg.(fileChangedMsg); ok {
+		next := watchCmd(m.watcher)
+		switch {
+		case m.selectedFile != m.watcher.path:
+			// Another document was opened since
+			return m, next
+		case msg.err != nil:
+			return m, tea.Batch(next, m.flash(fmt.Sprintf("Error reloading: %v", msg.err)))
+		case len(msg.doc.words) == 0:
+			return m, next
+		case m.typing():
+			// Reloading would drop what's been typed so far
+			m.heldReload = &msg.doc
+			return m, next
+		}
+		m.reload(msg.doc)
+		return m, tea.Batch(next, m.flash("Reloaded"))
+	}
+
+	if msg, ok := msg.(reloadedMsg); ok {
+		switch {
+		case m.selectedFile != msg.path:
+			return m, nil
+		case msg.err != nil:
+			return m, m.flash(fmt.Sprintf("Error reloading: %v", msg.err))
+		case len(msg.doc.words) == 0:
+			return m, m.flash("Not reloaded: no words found")
+		}
+		m.reload(msg.doc)
+		return m, m.flash("Reloaded")
+	}
+
+	if msg, ok := msg.(fetchedMsg); ok {
+		if !m.fetching || msg.url != strings.TrimSpace(m.urlInput.Value()) {
+			// Fetch was cancelled or superseded
+			return m, nil
+		}
+		m.stopFetch()
+		switch {
+		case msg.err != nil:
+			m.fileError = fmt.Sprintf("Error fetching URL: %v", msg.err)
+		case msg.feed != nil && len(msg.feed.entries) == 0:
+			m.fileError = "No entries in feed"
+		case msg.feed != nil:
+			m.feed, m.feedURL, m.feedCursor = msg.feed, msg.url, 0
+			m.showURLInput = false
+			m.urlInput.Blur()
+		case len(msg.doc.words) == 0:
+			m.fileError = "No words found in URL content"
+		default:
+			m.loadDocument(msg.doc, msg.url)
+			m.showURLInput = false
+		}
+		if msg.err == nil && msg.notice != "" {
+			return m, m.flash(msg.notice)
+		}
+		return m, nil
+	}
+
+	if msg, ok := msg.(listTitleMsg); ok {
+		if msg.title == "" {
+			return m, nil
+		}
+		entries, err := loadReadingList()
+		if err != nil {
+			return m, nil
+		}
+		for i := range entries {
+			if entries[i].Source == msg.source && entries[i].Title == "" {
+				entries[i].Title = msg.title
+			}
+		}
+		for i := range m.readingList {
+			if m.readingList[i].Source == msg.source && m.readingList[i].Title == "" {
+				m.readingList[i].Title = msg.title
+			}
+		}
+		if err := saveReadingList(entries); err != nil {
+			return m, m.flash(fmt.Sprintf("Error saving the reading list: %v", err))
+		}
+		return m, nil
+	}
+
+	if m.showList {
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			switch {
+			case key.Matches(msg, listKeys.Up):
+				m.listCursor = max(0, m.listCursor-1)
+			case key.Matches(msg, listKeys.Down):
+				m.listCursor = max(0, min(len(m.readingList)-1, m.listCursor+1))
+			case key.Matches(msg, listKeys.Select) && len(m.readingList) > 0:
+				return m, m.openListEntry(m.readingList[m.listCursor])
+			case key.Matches(msg, listKeys.Remove) && len(m.readingList) > 0:
+				m.readingList = slices.Delete(m.readingList, m.listCursor, m.listCursor+1)
+				m.listCursor = max(0, min(m.listCursor, len(m.readingList)-1))
+				if err := saveReadingList(m.readingList); err != nil {
+					return m, m.flash(fmt.Sprintf("Error saving the reading list: %v", err))
+				}
+			case key.Matches(msg, listKeys.Cancel):
+				m.showList = false
+				if len(m.words) == 0 {
+					// Started from the reading list with nothing else to read
+					m.quit = true
+					return m, tea.Quit
+				}
+			}
+			return m, nil
+		}
+		if _, ok := msg.(tea.MouseMsg); ok {
+			return m, nil
+		}
+	}
+
+	if m.feed != nil {
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			switch {
+			case key.Matches(msg, feedKeys.Up):
+				m.feedCursor = max(0, m.feedCursor-1)
+			case key.Matches(msg, feedKeys.Down):
+				m.feedCursor = min(len(m.feed.entries)-1, m.feedCursor+1)
+			case key.Matches(msg, feedKeys.PageUp):
+				m.feedCursor = max(0, m.feedCursor-m.feedPage())
+			case key.Matches(msg, feedKeys.PageDown):
+				m.feedCursor = min(len(m.feed.entries)-1, m.feedCursor+m.feedPage())
+			case key.Matches(msg, feedKeys.Select):
+				return m, m.openEntry(m.feed.entries[m.feedCursor])
+			case key.Matches(msg, feedKeys.Cancel):
+				m.feed = nil
+			}
+			return m, nil
+		}
+		if _, ok := msg.(tea.MouseMsg); ok {
+			return m, nil
+		}
+	}
+
+	if m.confirmQuit {
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			switch {
+			case key.Matches(msg, quitKeys.Cancel):
+				m.confirmQuit = false
+			case key.Matches(msg, quitKeys.Confirm), key.Matches(msg, m.keys.Quit), msg.String() == "ctrl+c":
+				// Pressing quit again confirms too
+				m.quit = true
+				return m, tea.Quit
+			}
+			return m, nil
+		}
+	}
+
+	if m.showGoto {
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			switch {
+			case key.Matches(msg, gotoKeys.Cancel):
+				m.showGoto = false
+				m.gotoInput.Blur()
+				return m, nil
+			case key.Matches(msg, gotoKeys.Submit):
+				idx, err := parseGoto(m.gotoInput.Value(), len(m.words))
+				if err != nil {
+					m.gotoError = err.Error()
+					return m, nil
+				}
+				m.showGoto = false
+				m.gotoInput.Blur()
+				m.jumpTo(idx)
+				return m, nil
+			}
+		}
+		var cmd tea.Cmd
+		m.gotoInput, cmd = m.gotoInput.Update(msg)
+		return m, cmd
+	}
+
+	if m.showURLInput {
+		switch msg := msg.(type) {
+		case tea.KeyMsg:
+			switch msg.String() {
+			case "esc":
+				m.showURLInput = false
+				m.stopFetch()
+				m.fileError = ""
+				m.urlInput.Blur()
+				return m, nil
+			case "enter":
+				if m.fetching {
+					return m, nil
+				}
+				urlStr := strings.TrimSpace(m.urlInput.Value())
+				if !isURL(urlStr) {
+					m.fileError = "Invalid URL"
+					return m, nil
+				}
+				return m, m.startFetch(urlStr)
+			case "ctrl+o":
+				m.showURLInput = false
+				m.stopFetch()
+				m.fileError = ""
+				m.urlInput.Blur()
+				return m, m.openPicker()
+			}
+			if m.fetching {
+				if msg.String() == "q" {
+					m.stopFetch()
+				}
+				return m, nil
+			}
+		case spinner.TickMsg:
+			if !m.fetching {
+				return m, nil
+			}
+			var cmd tea.Cmd
+			m.spinner, cmd = m.spinner.Update(msg)
+			return m, cmd
+		}
+
+		var cmd tea.Cmd
+		m.urlInput, cmd = m.urlInput.Update(msg)
+		return m, cmd
+	}
+
+	if m.showRecent {
+		if msg, ok := msg.(tea.KeyMsg); ok {
+			switch {
+			case key.Matches(msg, recentKeys.Up):
+				m.recentCursor = max(0, m.recentCursor-1)
+			case key.Matches(msg, recentKeys.Down):
+				m.recentCursor = min(len(m.recent)-1, m.recentCursor+1)
+			case key.Matches(msg, recentKeys.Select):
+				m.showRecent = false
+				return m, m.openFile(m.recent[m.recentCursor])
+			case key.Matches(msg, recentKeys.Browse):
+				return m, m.browse()
+			case key.Matches(msg, recentKeys.Cancel):
+				m.showRecent = false
+			}
+			return m, nil
+		}
+		if _, ok := msg.(tea.MouseMsg); ok {
+			return m, nil
+		}
+	}
+
+	if m.showPicker {
+		switch msg := msg.(type) {
+		case tea.KeyMsg:
+			if key.Matches(msg, fpKeys.Cancel) {
+				m.showPicker = false
+				return m, nil
+			}
+		}
+
+		var cmd tea.Cmd
+		m.filepicker, cmd = m.filepicker.Update(msg)
+		m.pickerDir = m.filepicker.CurrentDirectory
+
+		if didSelect, path := m.filepicker.DidSelectFile(msg); didSelect {
+			m.showPicker = false
+			if m.persist {
+				m.recent = loadRecentFiles().Files
+			}
+			return m, m.openFile(path)
+		}
+
+		return m, cmd
+	}
+
+	if msg, ok := msg.(clearCountMsg); ok {
+		if msg.id == m.countID {
+			m.count = 0
+		}
+		return m, nil
+	}
+
+	if _, ok := msg.(bellDoneMsg); ok {
+		m.ringing = false
+		return m, nil
+	}
+
+	if msg, ok := msg.(clearStatusMsg); ok {
+		if msg.id == m.statusMsgID {
+			m.statusMsg = ""
+			m.confirmRestart = false
+		}
+		return m, nil
+	}
+
+	if m.showMarks {
+		if _, ok := msg.(tea.KeyMsg); ok {
+			m.showMarks = false
+			return m, nil
+		}
+	}
+
+	if msg, ok := msg.(definedMsg); ok {
+		if msg.err == nil {
+			m.definitions[msg.word] = msg.def
+		} else if msg.word == m.defining {
+			m.defineErr = lookupError(msg.err)
+		}
+		return m, nil
+	}
+
+	if m.defining != "" {
+		if _, ok := msg.(tea.KeyMsg); ok {
+			m.defining = ""
+			return m, nil
+		}
+	}
+
+	if m.textView != nil {
+		switch msg := msg.(type) {
+		case tea.WindowSizeMsg:
+			top := m.textView.top()
+			m.layoutText(m.textView.from, m.textView.to)
+			m.textView.scrollTo(top, 0)
+		case tea.KeyMsg:
+			switch {
+			case key.Matches(msg, textKeys.Read):
+				m.jumpTo(m.textView.top())
+				m.textView = nil
+				return m, nil
+			case key.Matches(msg, textKeys.Back):
+				m.textView = nil
+				return m, nil
+			}
+			return m, m.scrollText(msg)
+		case tea.MouseMsg:
+			return m, m.scrollText(msg)
+		}
+	}
+
+	if msg, ok := msg.(tea.KeyMsg); ok && m.pendingKey != "" && !doubleKeys[m.pendingKey] {
+		pending := m.pendingKey
+		m.pendingKey = ""
+		letter := msg.String()
+		if len(letter) != 1 || !unicode.IsLetter(rune(letter[0])) {
+			return m, nil
+		}
+		if pending == "m" {
+			m.marks[letter] = m.currentIdx
+			if err := m.saveMarks(); err != nil {
+				return m, m.flash(fmt.Sprintf("Mark '%s set (not saved: %v)", letter, err))
+			}
+			return m, m.flash(fmt.Sprintf("Mark '%s set", letter))
+		}
+		idx, ok := m.marks[letter]
+		if !ok {
+			return m, m.flash(fmt.Sprintf("Mark '%s is not set", letter))
+		}
+		m.jumpTo(idx)
+		return m, nil
+	}
+
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if m.onBreak > 0 {
+			// Taking over ends the break; space skips straight back to reading
+			m.onBreak = 0
+			if key.Matches(msg, m.keys.PlayPause) {
+				m.play()
+				return m, tickCmd(m.wordDelay(m.currentIdx))
+			}
+		}
+
+		// Digits build up a count prefix for the next motion, as in vim
+		if d, ok := digitKey(msg); ok && (m.count > 0 || d > 0) {
+			m.count = min(m.count*10+d, maxCount)
+			m.countID++
+			id := m.countID
+			return m, tea.Tick(countTimeout, func(time.Time) tea.Msg {
+				return clearCountMsg{id: id}
+			})
+		}
+		count := m.count
+		m.count = 0
+		if count > 0 && msg.String() == "esc" {
+			// Esc only drops the count, rather than going on to quit
+			return m, nil
+		}
+
+		if m.confirmRestart {
+			// Any other key calls off the restart; esc does only that
+			m.confirmRestart = false
+			m.statusMsg = ""
+			if msg.String() == "esc" {
+				return m, nil
+			}
+			if key.Matches(msg, m.keys.Restart) {
+				m.restart()
+				return m, nil
+			}
+		}
+
+		// The first press of a doubled key waits for the second
+		if k := msg.String(); doubleKeys[k] && m.pendingKey != k {
+			m.pendingKey = k
+			m.count = count
+			return m, nil
+		}
+		m.pendingKey = ""
+
+		switch {
+		case msg.String() == "0":
+			// A bare 0 seeks to the start
+			m.seek(0)
+			return m, nil
+
+		case key.Matches(msg, m.keys.Seek):
+			if count == 0 {
+				return m, m.flash("Type a percentage before % to seek")
+			}
+			m.seek(min(count, 100))
+			return m, nil
+
+		case key.Matches(msg, m.keys.Goto):
+			m.showGoto = true
+			m.pause()
+			m.gotoError = ""
+			m.gotoInput.Reset()
+			return m, m.gotoInput.Focus()
+
+		case key.Matches(msg, m.keys.Quit):
+			if m.losesPlace() && msg.String() != "ctrl+c" {
+				m.pause()
+				m.confirmQuit = true
+				return m, nil
+			}
+			m.quit = true
+			return m, tea.Quit
+
+		case key.Matches(msg, m.keys.Help):
+			switch {
+			case m.hideHelp:
+				m.hideHelp = false
+			case m.help.ShowAll:
+				m.help.ShowAll = false
+				m.hideHelp = true
+			default:
+				m.help.ShowAll = true
+			}
+			return m, nil
+
+		case key.Matches(msg, m.keys.OpenFile):
+			return m, m.openPicker()
+
+		case key.Matches(msg, m.keys.ReadingList):
+			return m, tea.Batch(m.progressCmd(false), m.openReadingList())
+
+		case key.Matches(msg, m.keys.Reload):
+			if info, err := os.Stat(m.selectedFile); err != nil || !info.Mode().IsRegular() || len(m.files) > 1 {
+				return m, m.flash("Only a single file can be reloaded")
+			}
+			return m, reloadCmd(m.selectedFile)
+
+		case key.Matches(msg, m.keys.OpenURL):
+			m.showURLInput = true
+			m.pause()
+			m.fileError = ""
+			m.urlInput.Reset()
+			return m, m.urlInput.Focus()
+
+		case key.Matches(msg, m.keys.PlayPause):
+			return m, m.togglePlay()
+
+		case key.Matches(msg, m.keys.Undo):
+			return m, m.undoJump()
+
+		case key.Matches(msg, m.keys.Redo):
+			return m, m.redoJump()
+
+		case key.Matches(msg, m.keys.Reverse):
+			m.reverse = !m.reverse
+			if m.reverse {
+				return m, m.flash("Playing in reverse")
+			}
+			return m, m.flash("Playing forward")
+
+		case key.Matches(msg, m.keys.Prev):
+			m.jumpTo(m.currentIdx - countOr(count, 1))
+			return m, nil
+
+		case key.Matches(msg, m.keys.Next):
+			m.jumpTo(m.currentIdx + countOr(count, 1))
+			return m, nil
+
+		case key.Matches(msg, m.keys.Faster):
+			return m, m.adjustWPM(m.wpmStep)
+
+		case key.Matches(msg, m.keys.Slower):
+			return m, m.adjustWPM(-m.wpmStep)
+
+		case key.Matches(msg, m.keys.FasterFine):
+			return m, m.adjustWPM(m.wpmFineStep)
+
+		case key.Matches(msg, m.keys.SlowerFine):
+			return m, m.adjustWPM(-m.wpmFineStep)
+
+		case key.Matches(msg, m.keys.JumpBack):
+			m.jumpTo(m.currentIdx - countOr(count, m.jumpSize))
+			return m, nil
+
+		case key.Matches(msg, m.keys.JumpFwd):
+			m.jumpTo(m.currentIdx + countOr(count, m.jumpSize))
+			return m, nil
+
+		case key.Matches(msg, m.keys.PrevSentence):
+			m.jumpTo(prevBoundaryN(m.sentences, m.currentIdx, countOr(count, 1)))
+			return m, nil
+
+		case key.Matches(msg, m.keys.NextSentence):
+			m.jumpTo(nextBoundaryN(m.sentences, m.currentIdx, len(m.words)-1, countOr(count, 1)))
+			return m, nil
+
+		case key.Matches(msg, m.keys.PrevParagraph):
+			m.jumpTo(prevBoundaryN(m.paragraphs, m.currentIdx, countOr(count, 1)))
+			return m, nil
+
+		case key.Matches(msg, m.keys.NextParagraph):
+			m.jumpTo(nextBoundaryN(m.paragraphs, m.currentIdx, len(m.words)-1, countOr(count, 1)))
+			return m, nil
+
+		case key.Matches(msg, m.keys.PrevFile):
+			if len(m.files) > 0 {
+				m.jumpTo(prevBoundary(m.files, m.currentIdx))
+			}
+			return m, nil
+
+		case key.Matches(msg, m.keys.NextFile):
+			if i := sort.SearchInts(m.files, m.currentIdx+1); i < len(m.files) {
+				m.jumpTo(m.files[i])
+				return m, nil
+			}
+			if len(m.queue) > 0 {
+				return m, m.flash("The next file is still loading")
+			}
+			return m, nil
+
+		case key.Matches(msg, m.keys.SetMark), key.Matches(msg, m.keys.JumpMark):
+			if m.loader != nil {
+				// Marks belong to the whole document, so it must be loaded first
+				return m, m.flash("Marks are available once loading finishes")
+			}
+			if len(m.words) > 0 {
+				m.pendingKey = msg.String()
+			}
+			return m, nil
+
+		case key.Matches(msg, m.keys.ShowMarks):
+			m.showMarks = true
+			return m, nil
+
+		case key.Matches(msg, m.keys.Define):
+			if len(m.words) == 0 {
+				return m, nil
+			}
+			word := dictionaryForm(m.words[m.currentIdx])
+			if word == "" {
+				return m, m.flash("Nothing to look up")
+			}
+			m.pause()
+			m.defining, m.defineErr = word, ""
+			if _, ok := m.definitions[word]; ok {
+				return m, nil
+			}
+			return m, defineCmd(word)
+
+		case key.Matches(msg, m.keys.FullText):
+			if len(m.words) > 0 {
+				m.openText()
+			}
+			return m, nil
+
+		case key.Matches(msg, m.keys.Sentence):
+			m.showSentence = !m.showSentence
+			return m, nil
+
+		case key.Matches(msg, m.keys.StopAt):
+			i := slices.Index(stopModes, m.stopAt)
+			m.stopAt = stopModes[(i+1)%len(stopModes)]
+			if m.stopAt == "never" {
+				return m, m.flash("Playing straight through")
+			}
+			return m, m.flash("Stopping after each " + m.stopAt)
+
+		case key.Matches(msg, m.keys.Context):
+			i := slices.Index(contextModes, m.contextMode)
+			m.contextMode = contextModes[(i+1)%len(contextModes)]
+			return m, m.flash("Context: " + m.contextMode)
+
+		case key.Matches(msg, m.keys.Ghost):
+			m.showGhosts = !m.showGhosts
+			return m, nil
+
+		case key.Matches(msg, m.keys.Position):
+			m.hidePosition = !m.hidePosition
+			return m, nil
+
+		case key.Matches(msg, m.keys.CopyWord), key.Matches(msg, m.keys.CopySentence):
+			if len(m.words) == 0 {
+				return m, nil
+			}
+			text, what := m.words[m.currentIdx], "word"
+			if key.Matches(msg, m.keys.CopySentence) {
+				start, end := m.sentenceBounds(m.currentIdx)
+				text, what = strings.Join(m.words[start:end], " "), "sentence"
+			}
+			if err := clipboard.WriteAll(text); err != nil {
+				return m, m.flash(fmt.Sprintf("Couldn't copy %s: %v", what, err))
+			}
+			return m, m.flash("Copied " + what)
+
+		case key.Matches(msg, m.keys.Adaptive):
+			m.setAdaptive(!m.adaptive)
+			return m, nil
+
+		case key.Matches(msg, m.keys.Restart):
+			if m.partway() {
+				m.confirmRestart = true
+				return m, m.flash("Press " + m.keys.Restart.Help().Key + " again to restart (esc to cancel)")
+			}
+			m.restart()
+			return m, nil
+
+		case key.Matches(msg, m.keys.Start):
+			m.jumpTo(0)
+			return m, nil
+
+		case key.Matches(msg, m.keys.End):
+			m.pause()
+			m.jumpTo(len(m.words) - 1)
+			return m, nil
+		}
+
+	case tea.MouseMsg:
+		if msg.Action != tea.MouseActionPress {
+			return m, nil
+		}
+		switch msg.Button {
+		case tea.MouseButtonWheelUp:
+			return m, m.adjustWPM(m.wpmStep)
+		case tea.MouseButtonWheelDown:
+			return m, m.adjustWPM(-m.wpmStep)
+		case tea.MouseButtonLeft:
+			left := (m.width - m.progress.Width) / 2
+			switch {
+			case len(m.words) == 0:
+			case msg.Y == m.wordRow():
+				return m, m.togglePlay()
+			case msg.Y == m.progressRow() && msg.X >= left && msg.X < left+m.progress.Width:
+				m.jumpTo((msg.X - left) * len(m.words) / m.progress.Width)
+			}
+		}
+		return m, nil
+
+	case tea.BlurMsg:
+		if !m.paused || m.countdown > 0 || m.onBreak > 0 {
+			m.pause()
+			m.blurPaused = true
+		}
+		return m, nil
+
+	case tea.FocusMsg:
+		if m.blurPaused && m.focusResume {
+			m.blurPaused = false
+			return m, m.togglePlay()
+		}
+		return m, nil
+
+	case breakMsg:
+		if msg.id != m.breakID || m.onBreak == 0 {
+			return m, nil
+		}
+		m.onBreak--
+		if m.onBreak > 0 {
+			return m, breakCmd(m.breakID)
+		}
+		m.play()
+		return m, tickCmd(m.wordDelay(m.currentIdx))
+
+	case countdownMsg:
+		if msg.id != m.countdownID || m.countdown == 0 {
+			return m, nil
+		}
+		m.countdown--
+		if m.countdown > 0 {
+			return m, countdownCmd(m.countdownID)
+		}
+		m.play()
+		return m, tickCmd(m.wordDelay(m.currentIdx))
+
+	case tickMsg:
+		if m.paused {
+			return m, nil
+		}
+		if m.frame < len(m.frames())-1 {
+			m.frame++
+			return m, tickCmd(m.wordDelay(m.currentIdx))
+		}
+		if len(m.words) > 0 {
+			m.stats.wordsRead++
+			m.sampleWPM()
+		}
+		if m.reverse && m.currentIdx > 0 {
+			// Each word still reads forward, a frame at a time
+			m.currentIdx--
+			m.frame = 0
+			m.samplePace()
+			return m, m.nextWord()
+		}
+		if !m.reverse && m.currentIdx < len(m.words)-1 && m.stopsAfter(m.currentIdx) {
+			// Stay on the last word, letting what was read sink in
+			m.pause()
+			m.stopped = true
+			return m, nil
+		}
+		if !m.reverse && m.currentIdx < len(m.words)-1 {
+			m.currentIdx++
+			m.frame = 0
+			m.samplePace()
+			return m, m.nextWord()
+		}
+		if m.reverse || m.loader != nil {
+			// More may still arrive, so this isn't the end
+			m.pause()
+			m.atEnd = !m.reverse && m.following && m.loader != nil
+			return m, nil
+		}
+		return m, tea.Batch(m.ringBell(), m.progressCmd(true), m.finish())
+
+	case progress.FrameMsg:
+		progressModel, cmd := m.progress.Update(msg)
+		m.progress = progressModel.(progress.Model)
+		return m, cmd
+	}
+
+	return m, nil
+}
+
+// theme holds the colors used to draw the reader
+type theme struct {
+	text      lipgloss.TerminalColor
+	highlight lipgloss.TerminalColor // the ORP and mark letters
+	dim       lipgloss.TerminalColor
+	context   lipgloss.TerminalColor // words either side of the current one
+	status    lipgloss.TerminalColor
+	title     lipgloss.TerminalColor
+	alert     lipgloss.TerminalColor
+	code      lipgloss.TerminalColor // inline code spans
+	guide     lipgloss.TerminalColor // the focus guide; dim if unset
+	gradient  [2]string              // progress bar colors; empty for no color
+}
+
+// shade is a preset color given for each color profile: hex for terminals
+// that announce truecolor through COLORTERM, then a 256-color and a basic
+// ANSI number for more limited ones
+func shade(hex, ansi256, ansi string) lipgloss.CompleteColor {
+	return lipgloss.CompleteColor{TrueColor: hex, ANSI256: ansi256, ANSI: ansi}
+}
+
+// Named theme presets for -theme. Hex colors are matched to the nearest the
+// terminal supports, and none are used on terminals without color.
+var themes = map[string]theme{
+	"default": {
+		text: shade("#d4d4d8", "252", "7"), highlight: shade("#ff4d4d", "196", "9"), dim: shade("#5c5f66", "240", "8"),
+		context: shade("#4a4d55", "238", "8"), status: shade("#8b8f98", "245", "7"), title: shade("#f58ad6", "212", "13"),
+		alert: shade("#ff4d4d", "196", "9"), code: shade("#8bd58b", "114", "10"), gradient: [2]string{"#5A56E0", "#EE6FF8"},
+	},
+	"solarized-dark": {
+		text: lipgloss.Color("#93a1a1"), highlight: lipgloss.Color("#dc322f"), dim: lipgloss.Color("#586e75"),
+		context: lipgloss.Color("#586e75"), status: lipgloss.Color("#839496"), title: lipgloss.Color("#b58900"),
+		alert: lipgloss.Color("#dc322f"), code: lipgloss.Color("#859900"), gradient: [2]string{"#268bd2", "#2aa198"},
+	},
+	"dracula": {
+		text: lipgloss.Color("#f8f8f2"), highlight: lipgloss.Color("#ff5555"), dim: lipgloss.Color("#6272a4"),
+		context: lipgloss.Color("#6272a4"), status: lipgloss.Color("#bd93f9"), title: lipgloss.Color("#ff79c6"),
+		alert: lipgloss.Color("#ff5555"), code: lipgloss.Color("#50fa7b"), gradient: [2]string{"#bd93f9", "#ff79c6"},
+	},
+	"high-contrast": {
+		text: lipgloss.Color("15"), highlight: lipgloss.Color("9"), dim: lipgloss.Color("250"),
+		context: lipgloss.Color("248"), status: lipgloss.Color("15"), title: lipgloss.Color("11"),
+		alert: lipgloss.Color("9"), code: lipgloss.Color("10"), gradient: [2]string{"#FFFFFF", "#FFFF00"},
+	},
+	"light": {
+		text: shade("#24262b", "235", "0"), highlight: shade("#d0271d", "160", "1"), dim: shade("#7f838a", "244", "8"),
+		context: shade("#969aa2", "246", "8"), status: shade("#5c5f66", "240", "8"), title: shade("#b0266a", "125", "5"),
+		alert: shade("#d0271d", "160", "1"), code: shade("#1f8a3b", "28", "2"), gradient: [2]string{"#5A56E0", "#EE6FF8"},
+	},
+	"mono": {
+		text: lipgloss.NoColor{}, highlight: lipgloss.NoColor{}, dim: lipgloss.NoColor{},
+		context: lipgloss.NoColor{}, status: lipgloss.NoColor{}, title: lipgloss.NoColor{},
+		alert: lipgloss.NoColor{}, code: lipgloss.NoColor{},
+	},
+}
+
+// Other names accepted for theme presets
+var themeAliases = map[string]string{
+	"dark":      "default",
+	"solarized": "solarized-dark",
+}
+
+// themeNames lists the names accepted by -theme in order
+func themeNames() []string {
+	names := []string{"auto"}
+	for name := range themes {
+		names = append(names, name)
+	}
+	for name := range themeAliases {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// isThemeName reports whether name is accepted by -theme
+func isThemeName(name string) bool {
+	_, preset := themes[name]
+	_, alias := themeAliases[name]
+	return name == "auto" || preset || alias
+}
+
+// colorless reports whether c won't show as a color, being unset or on a
+// terminal without color such as TERM=dumb
+func colorless(c lipgloss.TerminalColor) bool {
+	_, none := c.(lipgloss.NoColor)
+	return none || lipgloss.ColorProfile() == termenv.Ascii
+}
+
+// lookupTheme returns the preset for a valid theme name. "auto" picks the
+// default or light theme to suit the terminal's background.
+func lookupTheme(name string) theme {
+	if name == "auto" {
+		name = "light"
+		if lipgloss.HasDarkBackground() {
+			name = "default"
+		}
+	}
+	if preset, ok := themeAliases[name]; ok {
+		name = preset
+	}
+	return themes[name]
+}
+
+// themeColors overrides individual colors of a theme from the config's
+// [colors] table, as ANSI color numbers or hex codes
+type themeColors struct {
+	Text      string   `toml:"text"`
+	Highlight string   `toml:"highlight"`
+	Dim       string   `toml:"dim"`
+	Context   string   `toml:"context"`
+	Status    string   `toml:"status"`
+	Title     string   `toml:"title"`
+	Alert     string   `toml:"alert"`
+	Code      string   `toml:"code"`
+	Guide     string   `toml:"guide"`
+	Gradient  []string `toml:"gradient"` // two hex codes
+}
+
+// withColors returns the theme with any colors set in c replacing its own
+func (t theme) withColors(c themeColors) (theme, error) {
+	for _, o := range []struct {
+		color *lipgloss.TerminalColor
+		value string
+	}{
+		{&t.text, c.Text}, {&t.highlight, c.Highlight}, {&t.dim, c.Dim},
+		{&t.context, c.Context}, {&t.status, c.Status}, {&t.title, c.Title},
+		{&t.alert, c.Alert}, {&t.code, c.Code}, {&t.guide, c.Guide},
+	} {
+		if o.value != "" {
+			*o.color = lipgloss.Color(o.value)
+		}
+	}
+	switch len(c.Gradient) {
+	case 0:
+	case 2:
+		t.gradient = [2]string{c.Gradient[0], c.Gradient[1]}
+	default:
+		return t, fmt.Errorf("colors.gradient needs two colors, got %d", len(c.Gradient))
+	}
+	return t, nil
+}
+
+// setTheme switches the reader's colors
+func (m *model) setTheme(t theme) {
+	m.theme = t
+	fill := progress.WithColorProfile(termenv.Ascii)
+	if t.gradient[0] != "" {
+		fill = progress.WithGradient(t.gradient[0], t.gradient[1])
+	}
+	m.progress = progress.New(fill, progress.WithWidth(40), progress.WithoutPercentage())
+	m.spinner.Style = lipgloss.NewStyle().Foreground(t.title)
+}
+
+// recentView draws the recently opened files to choose from
+func (m model) recentView() string {
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(m.theme.title)
+	textStyle := lipgloss.NewStyle().Foreground(m.theme.text)
+	dimStyle := lipgloss.NewStyle().Foreground(m.theme.dim)
+	cursorStyle := lipgloss.NewStyle().Foreground(m.theme.highlight).Bold(true)
+	width := max(20, min(72, m.width-8))
+
+	title := titleStyle.Render("Recent files")
+	titleLine := strings.Repeat(" ", max(0, (m.width-lipgloss.Width(title))/2)) + title
+
+	left := strings.Repeat(" ", max(0, (m.width-width)/2))
+	var list strings.Builder
+	for i, path := range m.recent {
+		name := truncateRight(filepath.Base(path), width-2)
+		dir := truncateLeft(filepath.Dir(path), max(0, width-4-uniseg.StringWidth(name)))
+		if i == m.recentCursor {
+			list.WriteString(left + cursorStyle.Render("> "+name) + "  " + dimStyle.Render(dir) + "\n")
+		} else {
+			list.WriteString(left + textStyle.Render("  "+name) + "  " + dimStyle.Render(dir) + "\n")
+		}
+	}
+
+	var helpLines strings.Builder
+	for line := range strings.SplitSeq(m.help.View(recentKeys), "\n") {
+		helpLines.WriteString(strings.Repeat(" ", max(0, (m.width-lipgloss.Width(line))/2)) + line + "\n")
+	}
+	return titleLine + "\n\n" + list.String() + "\n\n" + helpLines.String()
+}
+
+func (m model) View() string {
+	if m.ringing {
+		// Unchanged lines aren't drawn again, so it rings once
+		return "\a" + m.view()
+	}
+	return m.view()
+}
+
+// view draws the frame
+func (m model) view() string {
+	if m.quit {
+		return ""
+	}
+
+	if m.width == 0 || m.height == 0 {
+		return "Loading..."
+	}
+
+	if m.tooSmall() {
+		return m.tooSmallView()
+	}
+
+	if m.showRecent {
+		return m.recentView()
+	}
+
+	if m.showPicker {
+		titleStyle := lipgloss.NewStyle().Bold(true).Foreground(m.theme.title)
+
+		title := titleStyle.Render("Select a file to open")
+		titleLine := strings.Repeat(" ", max(0, (m.width-lipgloss.Width(title))/2)) + title
+
+		pickerHeight := m.height - 10
+		pickerStyle := lipgloss.NewStyle().Height(pickerHeight).MaxHeight(pickerHeight)
+		picker := pickerStyle.Render(m.filepicker.View())
+
+		fpHelp := m.help.View(fpKeys)
+		var helpLines strings.Builder
+		for line := range strings.SplitSeq(fpHelp, "\n") {
+			lineWidth := lipgloss.Width(line)
+			helpLines.WriteString(strings.Repeat(" ", max(0, (m.width-lineWidth)/2)) + line + "\n")
+		}
+
+		return titleLine + "\n\n" + picker + "\n\n\n\n" + helpLines.String()
+	}
+
+	if m.feed != nil {
+		return m.feedView()
+	}
+
+	if m.showList {
+		return m.listView()
+	}
+
+	if m.showGoto {
+		return m.gotoView()
+	}
+
+	if m.confirmQuit {
+		return m.quitView()
+	}
+
+	if m.showURLInput {
+		titleStyle := lipgloss.NewStyle().Bold(true).Foreground(m.theme.title)
+		errorStyle := lipgloss.NewStyle().Foreground(m.theme.alert)
+		statusStyle := lipgloss.NewStyle().Foreground(m.theme.status)
+
+		title := titleStyle.Render("Open a URL")
+		input := m.urlInput.View()
+
+		var status string
+		if m.fetching {
+			elapsed := time.Since(m.fetchStart).Truncate(time.Second)
+			status = m.spinner.View() + statusStyle.Render(fmt.Sprintf(" Fetching... %s (esc or q to cancel)", elapsed))
+		} else if m.fileError != "" {
+			status = errorStyle.Render(m.fileError) + statusStyle.Render(" · enter to retry")
+		}
+
+		var output strings.Builder
+		output.WriteString(strings.Repeat("\n", max(0, m.height/3)))
+		for _, line := range []string{title, "", input, "", status, ""} {
+			output.WriteString(strings.Repeat(" ", max(0, (m.width-lipgloss.Width(line))/2)) + line + "\n")
+		}
+		for line := range strings.SplitSeq(m.help.View(urlKeys), "\n") {
+			output.WriteString(strings.Repeat(" ", max(0, (m.width-lipgloss.Width(line))/2)) + line + "\n")
+		}
+		return output.String()
+	}
+
+	if m.defining != "" {
+		return m.definitionView()
+	}
+
+	if m.textView != nil {
+		return m.textViewView()
+	}
+
+	if m.showMarks {
+		titleStyle := lipgloss.NewStyle().Bold(true).Foreground(m.theme.title)
+		letterStyle := lipgloss.NewStyle().Foreground(m.theme.highlight).Bold(true)
+		snippetStyle := lipgloss.NewStyle().Foreground(m.theme.text)
+		dimStyle := lipgloss.NewStyle().Foreground(m.theme.dim)
+
+		letters := make([]string, 0, len(m.marks))
+		for letter := range m.marks {
+			letters = append(letters, letter)
+		}
+		sort.Strings(letters)
+
+		lines := []string{titleStyle.Render("Marks"), ""}
+		if len(letters) == 0 {
+			lines = append(lines, dimStyle.Render(truncateRight("No marks set. Press m followed by a letter to set one.", m.width)))
+		}
+		for _, letter := range letters {
+			idx := m.marks[letter]
+			lines = append(lines, letterStyle.Render(letter)+dimStyle.Render(" → ")+snippetStyle.Render(m.snippet(min(idx, len(m.words)-1))))
+		}
+		lines = append(lines, "", dimStyle.Render("press any key to close"))
+
+		var output strings.Builder
+		output.WriteString(strings.Repeat("\n", max(0, (m.height-len(lines))/3)))
+		for _, line := range lines {
+			output.WriteString(strings.Repeat(" ", max(0, (m.width-lipgloss.Width(line))/2)) + line + "\n")
+		}
+		return output.String()
+	}
+
+	if len(m.words) == 0 {
+		if m.loader != nil {
+			return "Loading…"
+		}
+		hint := fmt.Sprintf("Press '%s' to open a text file or '%s' to open a URL.", m.keys.OpenFile.Help().Key, m.keys.OpenURL.Help().Key)
+		if m.fileError != "" {
+			return m.fileError + ". " + hint
+		}
+		return "No words to display. " + hint
+	}
+
+	// Long words are shown a frame at a time to prevent UI overflow
+	frames := m.frames()
+	word := frames[min(m.frame, len(frames)-1)]
+
+	orpIdx := calculateORP(word)
+	clusters := graphemes(word)
+
+	normalStyle := lipgloss.NewStyle().Foreground(m.theme.text)
+	if m.inHeading(m.currentIdx) {
+		normalStyle = normalStyle.Foreground(m.theme.title).Bold(true)
+	}
+	if _, code := slices.BinarySearch(m.doc.code, m.currentIdx); code {
+		normalStyle = normalStyle.Foreground(m.theme.code)
+		if colorless(m.theme.code) {
+			normalStyle = normalStyle.Italic(true)
+		}
+	}
+	highlightStyle := lipgloss.NewStyle().Foreground(m.theme.highlight).Bold(true)
+	if colorless(m.theme.highlight) {
+		// Without color the focus letter needs another way to stand out
+		highlightStyle = highlightStyle.Underline(true)
+	}
+	dimStyle := lipgloss.NewStyle().Foreground(m.theme.dim)
+	contextStyle := lipgloss.NewStyle().Foreground(m.theme.context)
+	statusStyle := lipgloss.NewStyle().Foreground(m.theme.status)
+
+	// Measured in terminal cells, since CJK characters and emoji take two
+	charsBeforeORP := uniseg.StringWidth(strings.Join(clusters[:orpIdx], ""))
+	charsAfterORP := uniseg.StringWidth(word) - charsBeforeORP
+
+	halfWidth := m.halfWidth()
+	beforeSectionWidth := max(0, halfWidth-charsBeforeORP)
+	afterSectionWidth := max(0, halfWidth-charsAfterORP)
+	contextBefore := strings.Repeat(" ", beforeSectionWidth)
+	contextAfter := strings.Repeat(" ", afterSectionWidth)
+	if m.contextMode != "off" {
+		contextBefore, contextAfter = m.contextText(beforeSectionWidth, afterSectionWidth)
+	}
+	contextBeforeRendered := contextStyle.Render(contextBefore)
+	contextAfterRendered := contextStyle.Render(contextAfter)
+
+	var wordParts []string
+	for i, c := range clusters {
+		if i == orpIdx {
+			wordParts = append(wordParts, highlightStyle.Render(c))
+		} else {
+			wordParts = append(wordParts, normalStyle.Render(c))
+		}
+	}
+	renderedWord := strings.Join(wordParts, "")
+
+	// Words too long for the context width still keep the ORP on focusCol
+	leftPadding := max(0, m.focusCol-charsBeforeORP-beforeSectionWidth)
+
+	guideStyle := dimStyle
+	if m.theme.guide != nil {
+		guideStyle = lipgloss.NewStyle().Foreground(m.theme.guide)
+	}
+	guideLine := strings.Repeat(" ", m.focusCol) + guideStyle.Render(m.guideChar)
+	focusLine := guideLine
+	if m.guideMode == "off" {
+		focusLine = ""
+	}
+
+	wordLine := strings.Repeat(" ", leftPadding) + contextBeforeRendered + renderedWord + contextAfterRendered
+	if m.countdown > 0 {
+		wordLine = strings.Repeat(" ", m.focusCol) + highlightStyle.Render(fmt.Sprint(m.countdown))
+	}
+	if m.onBreak > 0 {
+		note := fmt.Sprintf("break — resuming in %ds", m.onBreak)
+		wordLine = strings.Repeat(" ", max(0, (m.width-uniseg.StringWidth(note))/2)) + dimStyle.Render(note)
+	}
+
+	progressPercent := float64(m.currentIdx+1) / float64(len(m.words))
+
+	remaining := m.remainingText()
+	if m.loader != nil {
+		// The total isn't known until the whole text has been read
+		remaining = "counting…"
+	}
+	var segments []string
+	switch {
+	case !m.statusShows("wpm"):
+	case m.ramping():
+		segments = append(segments, fmt.Sprintf("%d WPM (ramping to %d)", m.effectiveWPM(), m.ramp.to))
+	default:
+		segments = append(segments, fmt.Sprintf("%d WPM", m.wpm))
+	}
+	if m.statusShows("remaining") {
+		segments = append(segments, remaining)
+	}
+	if m.statusShows("elapsed") {
+		segments = append(segments, formatDuration(m.playingTime())+" elapsed")
+	}
+	if !m.hidePosition {
+		if m.loader != nil {
+			segments = append(segments, "word "+formatCount(m.currentIdx+1))
+		} else {
+			segments = append(segments, fmt.Sprintf("word %s / %s (%d%%)", formatCount(m.currentIdx+1), formatCount(len(m.words)), int(progressPercent*100)))
+		}
+	}
+	if m.warmingUp() {
+		segments = append(segments, fmt.Sprintf("warming up (%d WPM)", m.effectiveWPM()))
+	}
+	if m.adaptive {
+		segments = append(segments, "adaptive")
+	}
+	if m.stopAt != "never" {
+		segments = append(segments, "stop at "+m.stopAt+"s")
+	}
+	if len(m.files) > 1 || len(m.queue) > 0 {
+		i := sort.SearchInts(m.files, m.currentIdx+1) - 1
+		segments = append(segments, fmt.Sprintf("file %d/%d: %s", i+1, len(m.files)+len(m.queue), sourceName(m.fileNames[i])))
+	}
+	switch {
+	case m.loader != nil && m.following:
+		segments = append(segments, fmt.Sprintf("%s words (following…)", formatCount(len(m.words))))
+	case m.loader != nil:
+		segments = append(segments, fmt.Sprintf("%s words (loading…)", formatCount(len(m.words))))
+	}
+	if m.reverse {
+		segments = append(segments, "◀ reverse")
+	}
+	if m.blurPaused {
+		segments = append(segments, "paused (window unfocused)")
+	}
+	if m.count > 0 {
+		segments = append(segments, strconv.Itoa(m.count))
+	}
+	status := fitSegments(segments, m.width)
+	statusLine := statusStyle.Render(status)
+
+	progressBar := m.progress.ViewAs(progressPercent)
+
+	wordRowY := m.wordRow()
+
+	var output strings.Builder
+
+	// Ghost words only show with the word itself, and each side only when
+	// there is a word there
+	showGhosts := m.showGhosts && m.countdown == 0 && m.onBreak == 0
+	if wordRowY > 2 {
+		title := dimStyle.Render(truncateRight(m.docTitle(), max(0, m.width-4)))
+		output.WriteString(strings.Repeat(" ", max(0, (m.width-lipgloss.Width(title))/2)) + title + "\n")
+		output.WriteString(strings.Repeat("\n", wordRowY-3))
+		if showGhosts && m.currentIdx > 0 {
+			output.WriteString(m.ghostLine(m.words[m.currentIdx-1], contextStyle))
+		}
+		output.WriteString("\n")
+	} else {
+		output.WriteString(strings.Repeat("\n", max(0, wordRowY-1)))
+	}
+	output.WriteString(focusLine + "\n")
+	output.WriteString(wordLine + "\n")
+
+	gapHeight := m.height - wordRowY - 2 - m.bottomHeight()
+	if m.guideMode == "both" && gapHeight >= 1 {
+		output.WriteString(guideLine + "\n")
+		gapHeight--
+	}
+	if showGhosts && m.currentIdx+1 < len(m.words) && gapHeight >= 1 {
+		output.WriteString(m.ghostLine(m.words[m.currentIdx+1], contextStyle) + "\n")
+		gapHeight--
+	}
+	if m.showSentence && gapHeight >= 3 {
+		sentence := m.sentenceView(max(0, m.width-4), dimStyle, normalStyle.Bold(true))
+		output.WriteString("\n\n" + strings.Repeat(" ", max(0, (m.width-lipgloss.Width(sentence))/2)) + sentence + "\n")
+		gapHeight -= 3
+	}
+	output.WriteString(strings.Repeat("\n", max(0, gapHeight)))
+
+	progressWidth := lipgloss.Width(progressBar)
+	output.WriteString(strings.Repeat(" ", max(0, (m.width-progressWidth)/2)) + progressBar + "\n")
+	output.WriteString("\n")
+
+	output.WriteString(strings.Repeat(" ", max(0, (m.width-lipgloss.Width(statusLine))/2)) + statusLine + "\n")
+	if m.statusMsg != "" {
+		flashLine := statusStyle.Render(truncateRight(m.statusMsg, m.width))
+		output.WriteString(strings.Repeat(" ", max(0, (m.width-lipgloss.Width(flashLine))/2)) + flashLine)
+	} else if m.fileError != "" {
+		errorLine := lipgloss.NewStyle().Foreground(m.theme.alert).Render(truncateRight(m.fileError, m.width))
+		output.WriteString(strings.Repeat(" ", max(0, (m.width-lipgloss.Width(errorLine))/2)) + errorLine)
+	}
+	output.WriteString("\n")
+
+	if !m.hideHelp {
+		for line := range strings.SplitSeq(m.help.View(m.keys), "\n") {
+			lineWidth := lipgloss.Width(line)
+			output.WriteString(strings.Repeat(" ", max(0, (m.width-lineWidth)/2)) + line + "\n")
+		}
+	}
+
+	return output.String()
+}
+
+// gotoView draws the prompt for a word number or percentage to go to
+func (m model) gotoView() string {
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(m.theme.title)
+	errorStyle := lipgloss.NewStyle().Foreground(m.theme.alert)
+	statusStyle := lipgloss.NewStyle().Foreground(m.theme.status)
+
+	title := titleStyle.Render("Go to")
+	status := statusStyle.Render(fmt.Sprintf("word %s of %s", formatCount(m.currentIdx+1), formatCount(len(m.words))))
+	if m.gotoError != "" {
+		status = errorStyle.Render(m.gotoError)
+	}
+
+	var output strings.Builder
+	output.WriteString(strings.Repeat("\n", max(0, m.height/3)))
+	for _, line := range []string{title, "", m.gotoInput.View(), "", status, ""} {
+		output.WriteString(strings.Repeat(" ", max(0, (m.width-lipgloss.Width(line))/2)) + line + "\n")
+	}
+	for line := range strings.SplitSeq(m.help.View(gotoKeys), "\n") {
+		output.WriteString(strings.Repeat(" ", max(0, (m.width-lipgloss.Width(line))/2)) + line + "\n")
+	}
+	return output.String()
+}
+
+// Words into the document before a restart or quit asks first
+const confirmAfter = 50
+
+// restart goes back to the first word and pauses
+func (m *model) restart() {
+	if m.currentIdx > 0 {
+		m.remember()
+	}
+	m.currentIdx = 0
+	m.frame = 0
+	m.pause()
+}
+
+// partway reports whether the place is far enough into the document, and
+// short of its end, to ask before a restart or quit throws it away
+func (m model) partway() bool {
+	return !m.noConfirm && m.currentIdx >= confirmAfter && m.currentIdx < len(m.words)-1
+}
+
+// losesPlace reports whether quitting now would lose a place partway through
+// the document, which the reading list would otherwise have kept
+func (m model) losesPlace() bool {
+	return m.partway() && (m.listSource == "" || m.selectedFile != m.listSource)
+}
+
+// quitView draws the prompt confirming a quit partway through
+func (m model) quitView() string {
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(m.theme.title)
+	statusStyle := lipgloss.NewStyle().Foreground(m.theme.status)
+
+	title := titleStyle.Render("Quit? (y/n)")
+	status := statusStyle.Render(fmt.Sprintf("at word %s of %s", formatCount(m.currentIdx+1), formatCount(len(m.words))))
+
+	var output strings.Builder
+	output.WriteString(strings.Repeat("\n", max(0, m.height/3)))
+	for _, line := range []string{title, "", status, ""} {
+		output.WriteString(strings.Repeat(" ", max(0, (m.width-lipgloss.Width(line))/2)) + line + "\n")
+	}
+	for line := range strings.SplitSeq(m.help.View(quitKeys), "\n") {
+		output.WriteString(strings.Repeat(" ", max(0, (m.width-lipgloss.Width(line))/2)) + line + "\n")
+	}
+	return output.String()
+}
+
+// feedPage returns how many feed entries are listed at once
+func (m model) feedPage() int {
+	return max(1, m.height-10)
+}
+
+// feedView draws the list of feed entries to choose from
+func (m model) feedView() string {
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(m.theme.title)
+	textStyle := lipgloss.NewStyle().Foreground(m.theme.text)
+	dimStyle := lipgloss.NewStyle().Foreground(m.theme.dim)
+	cursorStyle := lipgloss.NewStyle().Foreground(m.theme.highlight).Bold(true)
+	width := max(20, min(72, m.width-8))
+
+	title := titleStyle.Render(cmp.Or(m.feed.title, "Feed"))
+	titleLine := strings.Repeat(" ", max(0, (m.width-lipgloss.Width(title))/2)) + title
+
+	// Keep the cursor in view, scrolling the list a page at a time
+	listHeight := m.feedPage()
+	first := m.feedCursor / listHeight * listHeight
+	last := min(len(m.feed.entries), first+listHeight)
+	left := strings.Repeat(" ", max(0, (m.width-width)/2))
+	var list strings.Builder
+	for i := first; i < last; i++ {
+		e := m.feed.entries[i]
+		date := ""
+		if !e.date.IsZero() {
+			date = "  " + e.date.Format(time.DateOnly)
+		}
+		// Dates line up at the right of the list
+		entry := truncateRight(e.title, width-2-len(date))
+		if date != "" {
+			entry += strings.Repeat(" ", max(0, width-2-len(date)-uniseg.StringWidth(entry)))
+		}
+		if i == m.feedCursor {
+			list.WriteString(left + cursorStyle.Render("> "+entry) + dimStyle.Render(date) + "\n")
+		} else {
+			list.WriteString(left + textStyle.Render("  "+entry) + dimStyle.Render(date) + "\n")
+		}
+	}
+	list.WriteString(strings.Repeat("\n", listHeight-(last-first)))
+
+	var helpLines strings.Builder
+	for line := range strings.SplitSeq(m.help.View(feedKeys), "\n") {
+		helpLines.WriteString(strings.Repeat(" ", max(0, (m.width-lipgloss.Width(line))/2)) + line + "\n")
+	}
+	return titleLine + "\n\n" + list.String() + "\n\n" + helpLines.String()
+}
+
+// listView draws the reading list to choose from
+func (m model) listView() string {
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(m.theme.title)
+	textStyle := lipgloss.NewStyle().Foreground(m.theme.text)
+	dimStyle := lipgloss.NewStyle().Foreground(m.theme.dim)
+	cursorStyle := lipgloss.NewStyle().Foreground(m.theme.highlight).Bold(true)
+	width := max(20, min(72, m.width-8))
+
+	title := titleStyle.Render("Reading list")
+	titleLine := strings.Repeat(" ", max(0, (m.width-lipgloss.Width(title))/2)) + title
+
+	listHeight := max(1, m.height-10)
+	left := strings.Repeat(" ", max(0, (m.width-width)/2))
+	var list strings.Builder
+	if len(m.readingList) == 0 {
+		list.WriteString(left + dimStyle.Render("Nothing to read yet: add to the list with skim add <url|file>") + "\n")
+		listHeight--
+	}
+	// Keep the cursor in view, scrolling the list a page at a time
+	first := m.listCursor / listHeight * listHeight
+	last := min(len(m.readingList), first+listHeight)
+	for i := first; i < last; i++ {
+		e := m.readingList[i]
+		var progress string
+		switch {
+		case e.Done:
+			progress = "✓ done"
+		case e.Percent > 0:
+			progress = fmt.Sprintf("%d%%", e.Percent)
+		}
+		name := truncateRight(e.name(), width-3-lipgloss.Width(progress))
+		pad := strings.Repeat(" ", max(1, width-2-lipgloss.Width(name)-lipgloss.Width(progress)))
+		if i == m.listCursor {
+			list.WriteString(left + cursorStyle.Render("> "+name) + pad + dimStyle.Render(progress) + "\n")
+		} else {
+			list.WriteString(left + textStyle.Render("  "+name) + pad + dimStyle.Render(progress) + "\n")
+		}
+	}
+	list.WriteString(strings.Repeat("\n", max(0, listHeight-(last-first))))
+
+	status := m.statusMsg
+	var helpLines strings.Builder
+	for line := range strings.SplitSeq(m.help.View(listKeys), "\n") {
+		helpLines.WriteString(strings.Repeat(" ", max(0, (m.width-lipgloss.Width(line))/2)) + line + "\n")
+	}
+	statusLine := strings.Repeat(" ", max(0, (m.width-lipgloss.Width(status))/2)) + dimStyle.Render(status)
+	return titleLine + "\n\n" + list.String() + "\n" + statusLine + "\n" + helpLines.String()
+}
+
+// definitionView draws the dictionary overlay for the word being defined
+func (m model) definitionView() string {
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(m.theme.title)
+	textStyle := lipgloss.NewStyle().Foreground(m.theme.text)
+	dimStyle := lipgloss.NewStyle().Foreground(m.theme.dim)
+	width := max(20, min(72, m.width-8))
+
+	def, found := m.definitions[m.defining]
+	title := titleStyle.Render(m.defining)
+	if def.phonetic != "" {
+		title += "  " + dimStyle.Render(def.phonetic)
+	}
+	lines := []string{title, ""}
+	switch {
+	case m.defineErr != "":
+		lines = append(lines, lipgloss.NewStyle().Foreground(m.theme.alert).Render(m.defineErr))
+	case !found:
+		lines = append(lines, dimStyle.Render("Looking up…"))
+	case len(def.senses) == 0:
+		lines = append(lines, dimStyle.Render("No definition found."))
+	}
+	for _, s := range def.senses {
+		text := dimStyle.Render(s.partOfSpeech) + " " + textStyle.Render(s.text)
+		lines = append(lines, strings.Split(lipgloss.NewStyle().Width(width).Render(text), "\n")...)
+	}
+	lines = append(lines, "", dimStyle.Render("press any key to close"))
+
+	var output strings.Builder
+	output.WriteString(strings.Repeat("\n", max(0, (m.height-len(lines))/3)))
+	left := strings.Repeat(" ", max(0, (m.width-width)/2))
+	for _, line := range lines {
+		output.WriteString(left + line + "\n")
+	}
+	return output.String()
+}
+
+// Words laid out either side of the current one when the full text view
+// opens; more are added as scrolling reaches either end, so huge documents
+// are never wrapped in full
+const textWindow = 2000
+
+// textView is the scrollable full text shown with the FullText key
+type textView struct {
+	viewport viewport.Model
+	from, to int   // words[from:to] are laid out
+	lines    []int // index of the first word on each line; blank lines take the next word's
+}
+
+// top returns the index of the first word on the top visible line
+func (tv *textView) top() int {
+	if len(tv.lines) == 0 {
+		return tv.from
+	}
+	return tv.lines[min(tv.viewport.YOffset, len(tv.lines)-1)]
+}
+
+// scrollTo scrolls so the line holding word idx is row rows from the top
+func (tv *textView) scrollTo(idx, row int) {
+	line := sort.Search(len(tv.lines), func(i int) bool { return tv.lines[i] > idx }) - 1
+	tv.viewport.SetYOffset(line - row)
+}
+
+// openText pauses and shows the full text centered on the current word
+func (m *model) openText() {
+	m.pause()
+	m.textView = &textView{viewport: viewport.New(0, 0)}
+	m.layoutText(m.currentIdx-textWindow, m.currentIdx+textWindow)
+	m.textView.scrollTo(m.currentIdx, m.textView.viewport.Height/2)
+}
+
+// layoutText wraps words[from:to] to the screen, starting at a paragraph,
+// into the full text view
+func (m *model) layoutText(from, to int) {
+	tv := m.textView
+	from = prevBoundary(m.paragraphs, max(0, from)+1)
+	to = max(from, min(to, len(m.words)))
+	tv.from, tv.to = from, to
+	tv.viewport.Width = m.width
+	tv.viewport.Height = max(1, m.height-3)
+	width := max(20, min(80, m.width-4))
+	margin := strings.Repeat(" ", max(0, (m.width-width)/2))
+
+	textStyle := lipgloss.NewStyle().Foreground(m.theme.text)
+	headingStyle := lipgloss.NewStyle().Foreground(m.theme.title).Bold(true)
+	wordStyle := lipgloss.NewStyle().Foreground(m.theme.highlight).Bold(true).Reverse(true)
+
+	var out strings.Builder
+	tv.lines = tv.lines[:0]
+	var line []string
+	start, lineWidth := from, 0
+	endLine := func(next int) {
+		if len(line) == 0 {
+			return
+		}
+		style := textStyle
+		if m.inHeading(start) {
+			style = headingStyle
+		}
+		text := style.Render(strings.Join(line, " "))
+		if m.currentIdx >= start && m.currentIdx < next {
+			i := m.currentIdx - start
+			before, after := strings.Join(line[:i], " "), strings.Join(line[i+1:], " ")
+			if before != "" {
+				before += " "
+			}
+			if after != "" {
+				after = " " + after
+			}
+			text = style.Render(before) + wordStyle.Render(line[i]) + style.Render(after)
+		}
+		tv.lines = append(tv.lines, start)
+		out.WriteString(margin + text + "\n")
+		line, start, lineWidth = line[:0], next, 0
+	}
+
+	p := sort.SearchInts(m.paragraphs, from+1)
+	for i := from; i < to; i++ {
+		if p < len(m.paragraphs) && m.paragraphs[p] == i {
+			p++
+			if i > from {
+				endLine(i)
+				tv.lines = append(tv.lines, i)
+				out.WriteString("\n")
+			}
+		}
+		w := uniseg.StringWidth(m.words[i])
+		if len(line) > 0 && lineWidth+1+w > width {
+			endLine(i)
+		}
+		if len(line) > 0 {
+			lineWidth++
+		}
+		line = append(line, m.words[i])
+		lineWidth += w
+	}
+	endLine(to)
+	tv.viewport.SetContent(strings.TrimSuffix(out.String(), "\n"))
+}
+
+// scrollText passes msg to the full text viewport, laying out more words
+// once either end is reached
+func (m *model) scrollText(msg tea.Msg) tea.Cmd {
+	tv := m.textView
+	var cmd tea.Cmd
+	tv.viewport, cmd = tv.viewport.Update(msg)
+	top := tv.top()
+	switch {
+	case tv.viewport.AtTop() && tv.from > 0:
+		m.layoutText(tv.from-textWindow, tv.to)
+	case tv.viewport.AtBottom() && tv.to < len(m.words):
+		m.layoutText(tv.from, tv.to+textWindow)
+	default:
+		return cmd
+	}
+	tv.scrollTo(top, 0)
+	return cmd
+}
+
+// textViewView draws the full text view
+func (m model) textViewView() string {
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(m.theme.title)
+	dimStyle := lipgloss.NewStyle().Foreground(m.theme.dim)
+	tv := m.textView
+	title := titleStyle.Render("Full text") + dimStyle.Render(fmt.Sprintf("  %d%%", 100*tv.top()/max(1, len(m.words))))
+	header := strings.Repeat(" ", max(0, (m.width-lipgloss.Width(title))/2)) + title
+	return header + "\n" + tv.viewport.View() + "\n" + m.help.View(textKeys)
+}
+
+// Smallest terminal the reader is laid out for
+const (
+	minWidth  = 40
+	minHeight = 12
+)
+
+func (m model) tooSmall() bool {
+	return m.width < minWidth || m.height < minHeight
+}
+
+// tooSmallView asks for a bigger terminal in place of a garbled reader
+func (m model) tooSmallView() string {
+	style := lipgloss.NewStyle().Foreground(m.theme.alert)
+	lines := []string{
+		"Terminal too small",
+		fmt.Sprintf("%dx%d, need %dx%d", m.width, m.height, minWidth, minHeight),
+	}
+	lines = lines[:min(len(lines), m.height)]
+	var output strings.Builder
+	output.WriteString(strings.Repeat("\n", max(0, (m.height-len(lines))/2)))
+	for i, line := range lines {
+		line = truncateRight(line, m.width)
+		output.WriteString(strings.Repeat(" ", max(0, (m.width-uniseg.StringWidth(line))/2)) + style.Render(line))
+		if i < len(lines)-1 {
+			output.WriteString("\n")
+		}
+	}
+	return output.String()
+}
+
+// Rows below the gap besides help: progress bar, status and flash
+const statusSectionHeight = 5
+
+// bottomHeight returns the rows below the gap, which depend on how much
+// help is shown
+func (m model) bottomHeight() int {
+	if m.hideHelp {
+		return statusSectionHeight
+	}
+	return statusSectionHeight + lipgloss.Height(m.help.View(m.keys))
+}
+
+// wordRow returns the screen row the current word is drawn on
+func (m model) wordRow() int {
+	return m.height/2 - 1
+}
+
+// progressRow returns the screen row the progress bar is drawn on
+func (m model) progressRow() int {
+	return m.wordRow() + 1 + max(0, m.height-m.wordRow()-2-m.bottomHeight())
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+	if d < time.Hour {
+		return fmt.Sprintf("%dm %ds", int(d.Minutes()), int(d.Seconds())%60)
+	}
+	return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// printMode selects plain output instead of the TUI: "words" writes the
+// tokens space-joined, "lines" writes one per line, and "paced" writes one
+// per line at the reading speed
+type printMode string
+
+func (p *printMode) String() string { return string(*p) }
+
+func (p *printMode) Set(v string) error {
+	switch v {
+	case "true", "words":
+		*p = "words"
+	case "lines", "paced":
+		*p = printMode(v)
+	case "false":
+		*p = ""
+	default:
+		return fmt.Errorf("must be words, lines or paced")
+	}
+	return nil
+}
+
+func (p *printMode) IsBoolFlag() bool { return true }
+
+// printWords writes the tokenized words to w in the given print mode
+func printWords(w io.Writer, words []string, mode printMode) error {
+	bw := bufio.NewWriter(w)
+	sep := " "
+	if mode == "lines" {
+		sep = "\n"
+	}
+	for i, word := range words {
+		if i > 0 {
+			bw.WriteString(sep)
+		}
+		bw.WriteString(word)
+	}
+	if len(words) > 0 {
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+// printPaced writes words one per line as playback would show them, each
+// held for the same delay the reader uses, until the words run out or ctx
+// is cancelled
+func printPaced(ctx context.Context, w io.Writer, m model, format string) error {
+	start := time.Now()
+	due := start
+	m.play()
+	for i := range m.words {
+		m.currentIdx = i
+		if _, err := io.WriteString(w, formatWord(format, m.words[i], i+1, time.Since(start))+"\n"); err != nil {
+			return err
+		}
+		if i == len(m.words)-1 {
+			break
+		}
+		due = due.Add(m.wordDuration(i, m.effectiveWPM()))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(due)):
+		}
+	}
+	return nil
+}
+
+// formatWord expands a paced print format: %w is the word, %i its number
+// and %t the milliseconds since printing began
+func formatWord(format, word string, n int, elapsed time.Duration) string {
+	return strings.NewReplacer(
+		"%%", "%",
+		"%w", word,
+		"%i", strconv.Itoa(n),
+		"%t", strconv.FormatInt(elapsed.Milliseconds(), 10),
+	).Replace(format)
+}
+
+// config holds defaults read from the config file; command-line flags
+// override them
+type config struct {
+	WPM            int      `toml:"wpm"`
+	MaxWPM         int      `toml:"max_wpm"`
+	WPMStep        int      `toml:"wpm_step"`
+	WPMFineStep    int      `toml:"wpm_fine_step"`
+	Reader         bool     `toml:"reader"`
+	Lang           string   `toml:"lang"`
+	URLs           string   `toml:"urls"`
+	RewindOnResume int      `toml:"rewind_on_resume"`
+	Adaptive       bool     `toml:"adaptive"`
+	EaseSentences  bool     `toml:"ease_sentences"`
+	FocusResume    bool     `toml:"resume_on_focus"`
+	NoContext      bool     `toml:"no_context"`
+	Context        string   `toml:"context"`
+	Guide          string   `toml:"guide"`
+	GuideChar      string   `toml:"guide_char"`
+	StopAt         string   `toml:"stop_at"`
+	KeyPreset      string   `toml:"key_preset"`
+	Status         []string `toml:"status"`
+	KeepRefs       bool     `toml:"keep_refs"`
+	NoPosition     bool     `toml:"no_position"`
+	NoSuspend      bool     `toml:"no_suspend"`
+	NoConfirm      bool     `toml:"no_confirm"`
+	ContextWidth   int      `toml:"context_width"`
+	AdaptiveScale  float64  `toml:"adaptive_scale"`
+	Warmup         bool     `toml:"warmup"`
+	Ramp           string   `toml:"ramp"`
+	Jump           int      `toml:"jump"`
+	Theme          string   `toml:"theme"`
+	LongWords      string   `toml:"long_words"`
+	BreakEvery     int      `toml:"break_every"`
+	BreakSecs      int      `toml:"break_secs"`
+	OnFinish       string   `toml:"on_finish"`
+	Bell           bool     `toml:"bell"`
+	CacheTTL       string   `toml:"cache_ttl"`
+	Proxy          string   `toml:"proxy"`
+
+	Keys   map[string]keyList `toml:"keys"` // action name to keys
+	Colors themeColors        `toml:"colors"`
+}
+
+func defaultConfig() config {
+	return config{
+		WPM:            500,
+		MaxWPM:         1500,
+		WPMStep:        25,
+		WPMFineStep:    5,
+		Reader:         true,
+		Lang:           "auto",
+		URLs:           "keep",
+		RewindOnResume: 3,
+		AdaptiveScale:  0.08,
+		Jump:           10,
+		ContextWidth:   halfWidth,
+		Context:        "wide",
+		Guide:          "above",
+		GuideChar:      "│",
+		StopAt:         "never",
+		KeyPreset:      "default",
+		Status:         statusSegments,
+		Theme:          "auto",
+		LongWords:      "split",
+		OnFinish:       "pause",
+		BreakSecs:      5,
+		CacheTTL:       "24h",
+	}
+}
+
+// configPath returns the location of the config file
+func configPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "skim", "config.toml"), nil
+}
+
+// loadConfig reads the config file over the defaults; a missing file is not an error
+func loadConfig() (config, error) {
+	cfg := defaultConfig()
+	path, err := configPath()
+	if err != nil {
+		return cfg, nil
+	}
+	md, err := toml.DecodeFile(path, &cfg)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return cfg, fmt.Errorf("%s: unknown key %q", path, undecoded[0].String())
+	}
+	return cfg, nil
+}
+
+// Main runs the skim command: it parses the command line, reads the text it
+// names and runs the reader until the user quits, exiting on errors
+func Main() {
+	if len(os.Args) > 1 && os.Args[1] == "add" {
+		if len(os.Args) < 3 {
+			fmt.Fprintln(os.Stderr, "Usage: skim add <url|file>...")
+			os.Exit(1)
+		}
+		if err := addToReadingList(os.Stdout, os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error adding to the reading list: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	// skim queue opens the reading list, taking the usual flags
+	showList := len(os.Args) > 1 && os.Args[1] == "queue"
+	if showList {
+		os.Args = slices.Delete(os.Args, 1, 2)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "stats" {
+		entries, err := readHistory()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading history: %v\n", err)
+			os.Exit(1)
+		}
+		printStats(os.Stdout, entries, time.Now())
+		return
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	ttl, err := time.ParseDuration(cfg.CacheTTL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading config: cache_ttl: %v\n", err)
+		os.Exit(1)
+	}
+
+	wpm := flag.Int("wpm", cfg.WPM, "Words per minute")
+	maxWPM := flag.Int("max-wpm", cfg.MaxWPM, "Maximum words per minute")
+	wpmStep := flag.Int("wpm-step", cfg.WPMStep, "WPM change for the faster/slower keys")
+	wpmFineStep := flag.Int("wpm-fine-step", cfg.WPMFineStep, "WPM change for the fine faster/slower keys")
+	reader := flag.Bool("reader", cfg.Reader, "Extract the main article from web pages")
+	lang := flag.String("lang", cfg.Lang, "Tokenization mode: auto, cjk or latin")
+	urls := flag.String("urls", cfg.URLs, "How to read URLs: keep, strip, or placeholder to read each as "+linkToken)
+	rewindOnResume := flag.Int("resume-rewind", cfg.RewindOnResume, "Words to rewind when resuming playback (0 for none)")
+	flag.IntVar(rewindOnResume, "rewind-on-resume", cfg.RewindOnResume, "Alias for -resume-rewind")
+	focusResume := flag.Bool("resume-on-focus", cfg.FocusResume, "Resume playback when the terminal regains focus after pausing on losing it")
+	contextWidth := flag.Int("context-width", cfg.ContextWidth, "Columns of context on each side of the focus letter")
+	noPosition := flag.Bool("no-position", cfg.NoPosition, "Leave the word position out of the status line (toggle with #)")
+	noContext := flag.Bool("no-context", cfg.NoContext, "Show only the focus word, without the words around it (same as -context off)")
+	keyPreset := flag.String("keys", cfg.KeyPreset, "Key preset: default, or vim for w/b sentences, gg/G start and end, d/u jumps and K to define")
+	statusOpt := flag.String("status", strings.Join(cfg.Status, ","), "Comma-separated status line segments to show: "+strings.Join(statusSegments, ", "))
+	stopAt := flag.String("stop-at", cfg.StopAt, "Pause after each sentence or paragraph until space is pressed: sentence, paragraph or never (cycle with s)")
+	guide := flag.String("guide", cfg.Guide, "Focus guide marks: above the word, both above and below, or off")
+	guideChar := flag.String("guide-char", cfg.GuideChar, "Character drawn as the focus guide")
+	contextOpt := flag.String("context", cfg.Context, "Context around the focus word: wide, narrow or off (cycle with c)")
+	adaptive := flag.Bool("adaptive", cfg.Adaptive, "Scale each word's display time by its length")
+	easeSentences := flag.Bool("ease-sentences", cfg.EaseSentences, "Slow down gradually over the last few words of each sentence")
+	adaptiveScale := flag.Float64("adaptive-scale", cfg.AdaptiveScale, "Adaptive timing change per character beyond the average word length")
+	warmup := flag.Bool("warmup", cfg.Warmup, "Ramp up to the target WPM over the first words")
+	rampSpec := flag.String("ramp", cfg.Ramp, "Ramp speed over playing time as FROM:TO:DURATION (e.g. 300:600:60s)")
+	jump := flag.Int("jump", cfg.Jump, "Words to move with [ and ]")
+	themeName := flag.String("theme", cfg.Theme, "Color theme: "+strings.Join(themeNames(), ", "))
+	flag.DurationVar(&cacheTTL, "cache-ttl", ttl, "How long a fetched page is used from the cache before checking for changes")
+	flag.BoolVar(&offline, "offline", false, "Read URLs from the cache only, without using the network")
+	flag.BoolVar(&refetch, "refetch", false, "Download URLs afresh instead of using the cache")
+	listCache := flag.Bool("list-cache", false, "List cached pages, numbered for -cached, and exit")
+	cachedNum := flag.Int("cached", 0, "Read the cached page with this number from -list-cache")
+	flag.Var(headerFlag(requestHeaders), "header", "Add a request header when fetching, as \"Name: Value\" (repeatable)")
+	cookie := flag.String("cookie", "", "Send a Cookie header when fetching, e.g. \"session=abc123\"")
+	basicAuth := flag.String("basic-auth", "", "Send HTTP basic auth when fetching, as user:pass")
+	bearer := flag.String("bearer", "", "Send a bearer token when fetching")
+	flag.DurationVar(&fetchTimeout, "timeout", fetchTimeout, "Time limit for each attempt at fetching a URL, e.g. 10s or 2m")
+	flag.IntVar(&fetchRetries, "retries", fetchRetries, "Times to retry a fetch after a connection error or a 5xx or 429 response")
+	flag.DurationVar(&retryWait, "retry-wait", retryWait, "Wait before the first fetch retry, doubling for each one after")
+	proxy := flag.String("proxy", cfg.Proxy, "Fetch through a proxy, e.g. http://host:port or socks5://host:port (default from HTTP_PROXY/HTTPS_PROXY)")
+	maxFetch := flag.String("max-fetch-size", byteSize(maxFetchSize).String(), "Largest page to download, e.g. 10MB or 512KB")
+	breakEvery := flag.Int("break-every", cfg.BreakEvery, "Take a short break after this many words of continuous playback (0 for none)")
+	breakSecs := flag.Int("break-secs", cfg.BreakSecs, "Length of breaks in seconds")
+	onFinish := flag.String("on-finish", cfg.OnFinish, "What to do after the last word: pause, quit or loop")
+	bell := flag.Bool("bell", cfg.Bell, "Ring the terminal bell after the last word")
+	longWordsOpt := flag.String("long-words", cfg.LongWords, "How to show words too long for the screen: split or truncate")
+	noMouse := flag.Bool("no-mouse", false, "Disable mouse support")
+	noConfirm := flag.Bool("no-confirm", cfg.NoConfirm, "Quit or restart without asking first, even partway through a document")
+	noSuspend := flag.Bool("no-suspend", cfg.NoSuspend, "Don't suspend to the shell on ctrl+z")
+	noStats := flag.Bool("no-stats", false, "Don't print a reading summary on quit")
+	var printOpt printMode
+	raw := flag.Bool("raw", false, "Read markdown syntax as-is instead of stripping it")
+	flag.BoolVar(&keepRefs, "keep-refs", cfg.KeepRefs, "Keep citation markers and long URLs in web pages")
+	readCodeOpt := flag.Bool("read-code", false, "Read markdown code blocks instead of folding each into one word")
+	fromClipboard := flag.Bool("clipboard", false, "Read text from the system clipboard")
+	watch := flag.Bool("watch", false, "Reload the file when it changes on disk")
+	flag.StringVar(&jsonPath, "json-path", "", "Read the string (or array of strings) at this path in JSON input, e.g. data.items[0].body")
+	flag.BoolVar(&forceJSON, "json", false, "Read input as JSON even without a .json extension or JSON content type")
+	noStripANSI := flag.Bool("no-strip-ansi", false, "Keep terminal escape sequences and backspace overstrikes in files and piped text")
+	follow := flag.Bool("follow", false, "Keep reading a growing file or stream as text arrives, like tail -f")
+	flag.Var(&printOpt, "print", "Print the tokenized words instead of reading them (words, lines, or paced to print one line per word at the reading speed)")
+	printFormat := flag.String("print-format", "%w", "Line format for -print=paced: %w word, %i word number, %t elapsed milliseconds")
+	flag.Parse()
+
+	switch *lang {
+	case "auto", "cjk", "latin":
+		langMode = *lang
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid -lang %q: must be auto, cjk or latin\n", *lang)
+		os.Exit(1)
+	}
+	switch *urls {
+	case "keep", "strip", "placeholder":
+		urlMode = *urls
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid -urls %q: must be keep, strip or placeholder\n", *urls)
+		os.Exit(1)
+	}
+	if !isThemeName(*themeName) {
+		fmt.Fprintf(os.Stderr, "Invalid -theme %q: must be one of %s\n", *themeName, strings.Join(themeNames(), ", "))
+		os.Exit(1)
+	}
+	selectedTheme := themes["mono"]
+	if os.Getenv("NO_COLOR") == "" {
+		selectedTheme, err = lookupTheme(*themeName).withColors(cfg.Colors)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	size, err := parseByteSize(*maxFetch)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -max-fetch-size: %v\n", err)
+		os.Exit(1)
+	}
+	maxFetchSize = int64(size)
+	switch *onFinish {
+	case "pause", "quit", "loop":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid -on-finish %q: must be pause, quit or loop\n", *onFinish)
+		os.Exit(1)
+	}
+	switch *longWordsOpt {
+	case "split", "truncate":
+		longWords = *longWordsOpt
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid -long-words %q: must be split or truncate\n", *longWordsOpt)
+		os.Exit(1)
+	}
+	if *cookie != "" {
+		requestHeaders.Add("Cookie", *cookie)
+	}
+	if *basicAuth != "" {
+		if !strings.Contains(*basicAuth, ":") {
+			fmt.Fprintln(os.Stderr, "Invalid -basic-auth: must be user:pass")
+			os.Exit(1)
+		}
+		requestHeaders.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(*basicAuth)))
+	}
+	if *bearer != "" {
+		requestHeaders.Set("Authorization", "Bearer "+*bearer)
+	}
+	var statusParts []string
+	if *statusOpt != "" {
+		statusParts = strings.Split(*statusOpt, ",")
+	}
+	for _, name := range statusParts {
+		if !slices.Contains(statusSegments, name) {
+			fmt.Fprintf(os.Stderr, "Invalid -status segment %q: must be one of %s\n", name, strings.Join(statusSegments, ", "))
+			os.Exit(1)
+		}
+	}
+	if !slices.Contains(stopModes, *stopAt) {
+		fmt.Fprintf(os.Stderr, "Invalid -stop-at %q: must be sentence, paragraph or never\n", *stopAt)
+		os.Exit(1)
+	}
+	if !slices.Contains(guideModes, *guide) {
+		fmt.Fprintf(os.Stderr, "Invalid -guide %q: must be above, both or off\n", *guide)
+		os.Exit(1)
+	}
+	if uniseg.StringWidth(*guideChar) != 1 {
+		fmt.Fprintln(os.Stderr, "Invalid -guide-char: must be a single character one cell wide")
+		os.Exit(1)
+	}
+	if !slices.Contains(contextModes, *contextOpt) {
+		fmt.Fprintf(os.Stderr, "Invalid -context %q: must be wide, narrow or off\n", *contextOpt)
+		os.Exit(1)
+	}
+	if *noContext {
+		*contextOpt = "off"
+	}
+	if *contextWidth <= 0 {
+		fmt.Fprintln(os.Stderr, "Invalid -context-width: must be positive")
+		os.Exit(1)
+	}
+	if fetchTimeout <= 0 {
+		fmt.Fprintln(os.Stderr, "Invalid -timeout: must be positive")
+		os.Exit(1)
+	}
+	if *proxy != "" {
+		proxyURL, err = parseProxy(*proxy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -proxy: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if _, err := splitJSONPath(jsonPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -json-path: %v\n", err)
+		os.Exit(1)
+	}
+	if _, ok := keyPresets[*keyPreset]; !ok {
+		fmt.Fprintf(os.Stderr, "Invalid -keys %q: must be default or vim\n", *keyPreset)
+		os.Exit(1)
+	}
+	for _, problem := range remapKeys(applyKeyPreset(*keyPreset, cfg.Keys)) {
+		fmt.Fprintf(os.Stderr, "Warning: config [keys]: %s\n", problem)
+	}
+	setDoubleKeys(*keyPreset)
+	rawMarkdown = *raw
+	keys.Suspend.SetEnabled(!*noSuspend)
+	readCode = *readCodeOpt
+	stripEscapes = !*noStripANSI
+
+	*maxWPM = max(minWPM, *maxWPM)
+	*wpm = clampWPM(*wpm, *maxWPM)
+
+	var ramp *speedRamp
+	if *rampSpec != "" {
+		r, err := parseRamp(*rampSpec, *maxWPM)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -ramp: %v\n", err)
+			os.Exit(1)
+		}
+		ramp = &r
+		*wpm = r.to
+	}
+
+	var doc document
+	var source string // where the document came from, for the reading history
+	var fetchOnStart string
+	var loader *textLoader // streams stdin or a file once the reader starts
+	var queue []string     // files and URLs read back to back
+	args := flag.Args()
+
+	if *listCache || *cachedNum != 0 {
+		pages, err := listCachedPages()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading the cache: %v\n", err)
+			os.Exit(1)
+		}
+		if *listCache {
+			printCachedPages(os.Stdout, pages)
+			return
+		}
+		if *cachedNum < 1 || *cachedNum > len(pages) {
+			fmt.Fprintf(os.Stderr, "No cached page %d: see -list-cache\n", *cachedNum)
+			os.Exit(1)
+		}
+		// The cached copy is read however old it is
+		args = []string{pages[*cachedNum-1].URL}
+		offline = true
+	}
+
+	// Check if stdin has piped data
+	stdinInfo, _ := os.Stdin.Stat()
+	hasStdin := (stdinInfo.Mode() & os.ModeCharDevice) == 0
+
+	if *fromClipboard {
+		source = "clipboard"
+		content, err := clipboard.ReadAll()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading clipboard: %v\n", err)
+			os.Exit(1)
+		}
+		text, ok := decodeText([]byte(content))
+		if !ok {
+			fmt.Fprintln(os.Stderr, "Cannot read binary content from the clipboard")
+			os.Exit(1)
+		}
+		doc = parseDocument(text)
+		if len(doc.words) == 0 {
+			fmt.Fprintln(os.Stderr, "No words found in clipboard")
+			os.Exit(1)
+		}
+	} else if hasStdin {
+		// Stream from stdin
+		source = "stdin"
+		if forceJSON {
+			loader, err = newJSONLoader(os.Stdin)
+		} else {
+			loader, err = newTextLoader(os.Stdin, nil, false)
+		}
+		if errors.Is(err, errBinaryFile) {
+			fmt.Fprintln(os.Stderr, "Cannot read binary content from stdin")
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading from stdin: %v\n", err)
+			os.Exit(1)
+		}
+	} else if len(args) > 1 {
+		source = strings.Join(args, " ")
+		queue = expandSources(args, os.Stderr)
+		if len(queue) == 0 {
+			fmt.Fprintln(os.Stderr, "No text files found")
+			os.Exit(1)
+		}
+	} else if len(args) == 1 {
+		source = args[0]
+
+		// Check if the source is a URL
+		if isURL(source) && printOpt == "" {
+			// Fetched once the reader is running
+			fetchOnStart = source
+		} else if isURL(source) {
+			page, err := fetchPage(context.Background(), source)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error fetching URL: %v\n", err)
+				os.Exit(1)
+			}
+			if page.stale {
+				fmt.Fprintln(os.Stderr, page.staleNotice())
+			}
+
+			doc, err = page.document(*reader)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading URL content: %v\n", err)
+				os.Exit(1)
+			}
+
+			if len(doc.words) == 0 {
+				fmt.Fprintln(os.Stderr, "No words found in URL content")
+				os.Exit(1)
+			}
+		} else if info, err := os.Stat(source); err == nil && info.IsDir() {
+			queue, err = dirFiles(source)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading directory: %v\n", err)
+				os.Exit(1)
+			}
+			if len(queue) == 0 {
+				fmt.Fprintf(os.Stderr, "No text files found in %s\n", source)
+				os.Exit(1)
+			}
+		} else {
+			// Treat as a file path
+			loader, err = openTextFile(source)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	// newModel sets up the reader as configured, for playback or paced printing
+	newModel := func(doc document) model {
+		m := initialModel(doc, *wpm)
+		m.selectedFile = source
+		m.reader = *reader
+		m.rewindOnResume = max(0, *rewindOnResume)
+		m.adaptive = *adaptive
+		m.easeSentences = *easeSentences
+		m.focusResume = *focusResume
+		m.mouse = !*noMouse
+		m.noConfirm = *noConfirm
+		m.contextMode = *contextOpt
+		m.guideMode = *guide
+		m.guideChar = *guideChar
+		m.stopAt = *stopAt
+		m.statusParts = statusParts
+		m.hidePosition = *noPosition || !slices.Contains(statusParts, "position")
+		m.contextWidth = *contextWidth
+		m.onFinish = *onFinish
+		m.breakEvery = max(0, *breakEvery)
+		m.breakSecs = *breakSecs
+		m.bell = *bell
+		m.setAdaptiveScale(max(0, *adaptiveScale))
+		m.warmup = *warmup
+		m.ramp = ramp
+		m.setJumpSize(max(1, *jump))
+		m.maxWPM = *maxWPM
+		m.wpmStep = max(1, *wpmStep)
+		m.wpmFineStep = max(1, *wpmFineStep)
+		m.setTheme(selectedTheme)
+		m.cache = true
+		m.restoreState()
+		return m
+	}
+
+	if printOpt != "" {
+		if queue != nil {
+			doc = readQueue(queue, *reader, os.Stderr)
+		}
+		if loader != nil {
+			doc, err = loader.readAll()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", source, err)
+				os.Exit(1)
+			}
+		}
+		if len(doc.words) == 0 && (loader != nil || queue != nil) {
+			fmt.Fprintf(os.Stderr, "No words found in %s\n", source)
+			os.Exit(1)
+		}
+		if len(doc.words) == 0 {
+			fmt.Fprintln(os.Stderr, "Nothing to print: provide a file, URL or stdin")
+			os.Exit(1)
+		}
+		if printOpt == "paced" {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			err = printPaced(ctx, os.Stdout, newModel(doc), *printFormat)
+		} else {
+			err = printWords(os.Stdout, doc.words, printOpt)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Set up program options
+	opts := []tea.ProgramOption{tea.WithAltScreen(), tea.WithReportFocus()}
+	if !*noMouse {
+		opts = append(opts, tea.WithMouseCellMotion())
+	}
+
+	// If stdin was used for content, we need to reopen /dev/tty for keyboard input
+	if hasStdin {
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening /dev/tty for input: %v\n", err)
+			os.Exit(1)
+		}
+		defer tty.Close()
+		opts = append(opts, tea.WithInput(tty))
+	}
+
+	m := newModel(doc)
+	if *follow {
+		if loader == nil {
+			fmt.Fprintln(os.Stderr, "-follow needs a file or stdin to read")
+			os.Exit(1)
+		}
+		// Pipes end when the writer is done, but files can always grow
+		loader.follow(!hasStdin || stdinInfo.Mode().IsRegular())
+		m.following = true
+	}
+	if loader != nil {
+		m.startup, err = m.startLoading(loader, source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", source, err)
+			os.Exit(1)
+		}
+		m.showPicker = false
+	}
+	if queue != nil {
+		m.startup = m.startQueue(queue, source)
+		m.showPicker = false
+	}
+	if showList {
+		m.showPicker = false
+		m.startup = m.openReadingList()
+	}
+	if fetchOnStart != "" {
+		m.showPicker = false
+		m.showURLInput = true
+		m.urlInput.SetValue(fetchOnStart)
+		m.startup = tea.Batch(m.urlInput.Focus(), m.startFetch(fetchOnStart))
+	}
+	if *watch {
+		if loader == nil || hasStdin {
+			fmt.Fprintln(os.Stderr, "-watch needs a file to read")
+			os.Exit(1)
+		}
+		w, err := watchFile(source)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error watching %s: %v\n", source, err)
+			os.Exit(1)
+		}
+		defer w.close()
+		m.watcher = w
+		m.startup = tea.Batch(m.startup, watchCmd(w))
+	}
+
+	// Save the terminal's title to restore on exit, in terminals that keep a
+	// stack of titles, as long as the output is a terminal at all
+	stdoutInfo, _ := os.Stdout.Stat()
+	titleStack := stdoutInfo != nil && stdoutInfo.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb"
+	if titleStack {
+		fmt.Print("\x1b[22;0t")
+	}
+	p := tea.NewProgram(m, opts...)
+	final, err := p.Run()
+	if titleStack {
+		fmt.Print("\x1b[23;0t")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fm := final.(model)
+	if err := fm.saveProgress(false); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving the reading list: %v\n", err)
+	}
+	if fm.stats.wordsRead > 0 {
+		if err := appendHistory(fm.historyEntry()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving reading history: %v\n", err)
+		}
+	}
+	if !*noStats {
+		if s := fm.summary(); s != "" {
+			fmt.Println(s)
+		}
+		if s := fm.speedLine(cmp.Or(fm.width, 80)); s != "" {
+			fmt.Println(s)
+		}
+	}
+}
@@ -0,0 +1,1056 @@
+package skim
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/rivo/uniseg"
+)
+
+// TestMain keeps state, data and cache files written by the tests out of the
+// user's own directories
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "skim-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, name := range []string{"HOME", "XDG_CONFIG_HOME", "XDG_STATE_HOME", "XDG_DATA_HOME", "XDG_CACHE_HOME"} {
+		os.Setenv(name, dir)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestModel returns a reader for words sized to a terminal of width by
+// height cells
+func newTestModel(tb testing.TB, words []string, width, height int) model {
+	tb.Helper()
+	m := initialModel(document{words: words}, 300)
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: width, Height: height})
+	return updated.(model)
+}
+
+// viewLines renders the model's view without styling, one string per line
+func viewLines(m model) []string {
+	return strings.Split(ansi.Strip(m.View()), "\n")
+}
+
+// press sends keys to the model one at a time. Each is a key name as
+// tea.KeyMsg.String gives it, or a run of characters typed in turn.
+func press(m model, keys ...string) model {
+	named := map[string]tea.KeyType{"esc": tea.KeyEscape, "enter": tea.KeyEnter}
+	for _, k := range keys {
+		var msgs []tea.KeyMsg
+		if t, ok := named[k]; ok {
+			msgs = append(msgs, tea.KeyMsg{Type: t})
+		} else {
+			for _, r := range k {
+				msgs = append(msgs, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+			}
+		}
+		for _, msg := range msgs {
+			updated, _ := m.Update(msg)
+			m = updated.(model)
+		}
+	}
+	return m
+}
+
+// corpus returns n distinct words
+func corpus(n int) []string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fmt.Sprintf("word%d", i)
+	}
+	return words
+}
+
+func TestViewContextIndependentOfDocumentLength(t *testing.T) {
+	// The short document holds the long one's last tail words, which is more
+	// than the context can show on either side of the word
+	const tail = 100
+	big := corpus(500_000)
+	long := newTestModel(t, big, 120, 30)
+	short := newTestModel(t, big[len(big)-tail:], 120, 30)
+	tests := []struct {
+		name string
+		idx  int // position in the short document
+	}{
+		{"middle", tail / 2},
+		{"near the end", tail - 3},
+		{"last word", tail - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			long.jumpTo(len(big) - tail + tt.idx)
+			short.jumpTo(tt.idx)
+
+			got := viewLines(long)[long.wordRow()]
+			want := viewLines(short)[short.wordRow()]
+			if got != want {
+				t.Errorf("context row\n got %q\nwant %q", got, want)
+			}
+		})
+	}
+}
+
+// cellAt returns the grapheme that starts at column col of a line, or "" if
+// none does
+func cellAt(line string, col int) string {
+	g := uniseg.NewGraphemes(line)
+	for pos := 0; g.Next(); pos += g.Width() {
+		if pos == col {
+			return g.Str()
+		}
+		if pos > col {
+			break
+		}
+	}
+	return ""
+}
+
+// orpTests pair words with the grapheme their ORP should fall on
+var orpTests = []struct {
+	name string
+	word string
+	want string
+}{
+	{"ascii", "hello", "e"},
+	{"single letter", "a", "a"},
+	{"long word", "internationalization", "r"},
+	{"combining accent", "ne\u0301e", "e\u0301"},
+	{"combining accent before", "e\u0301tude", "t"},
+	{"emoji with skin tone", "a👍🏽", "👍🏽"},
+	{"zwj sequence", "x👨\u200d👩\u200d👧", "👨\u200d👩\u200d👧"},
+	{"zwj sequence before", "👩\u200d💻code", "c"},
+	{"flag", "a🇯🇵", "🇯🇵"},
+	{"cjk", "日本語", "日"},
+	{"cjk with punctuation", "ある。", "あ"},
+	{"wide latin", "ａｂｃ", "ｂ"},
+	{"diacritic on the orp", "ni\u0308", "i\u0308"},
+	{"diacritic after the orp", "nai\u0308ve", "a"},
+	{"precomposed diacritic", "naïve", "a"},
+}
+
+func TestCalculateORP(t *testing.T) {
+	for _, tt := range orpTests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusters := graphemes(tt.word)
+			idx := calculateORP(tt.word)
+			if idx >= len(clusters) {
+				t.Fatalf("calculateORP(%q) = %d, past the word's %d graphemes", tt.word, idx, len(clusters))
+			}
+			if got := clusters[idx]; got != tt.want {
+				t.Errorf("calculateORP(%q) falls on %q, want %q", tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestViewKeepsORPOnFocusColumn(t *testing.T) {
+	// Wide characters in the context must not shift the word either
+	neighbours := map[string][]string{
+		"latin": {"some", "words", "before", "and", "after", "it"},
+		"cjk":   {"東", "京", "タ", "ワ", "ー", "は"},
+	}
+	for context, around := range neighbours {
+		for _, tt := range orpTests {
+			t.Run(context+"/"+tt.name, func(t *testing.T) {
+				words := slices.Insert(slices.Clone(around), 3, tt.word)
+				m := newTestModel(t, words, 100, 24)
+				m.jumpTo(3)
+				row := viewLines(m)[m.wordRow()]
+				if got := cellAt(row, m.focusCol); got != tt.want {
+					t.Errorf("column %d of %q is %q, want %q", m.focusCol, row, got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+// words returns the text of tokens
+func words(tokens []token) []string {
+	out := make([]string, len(tokens))
+	for i, t := range tokens {
+		out[i] = t.text
+	}
+	return out
+}
+
+func TestTokenizeJapanese(t *testing.T) {
+	tests := []struct {
+		name string
+		lang string
+		text string
+		want []string
+	}{
+		{
+			"punctuation stays with its character", "auto", "吾輩は猫である。名前はまだ無い。",
+			[]string{"吾", "輩", "は", "猫", "で", "あ", "る。", "名", "前", "は", "ま", "だ", "無", "い。"},
+		},
+		{
+			"latin words and numbers stay whole", "auto", "東京タワーは1958年に完成。Tokyo Tower",
+			[]string{"東", "京", "タ", "ワ", "ー", "は", "1958", "年", "に", "完", "成。", "Tokyo", "Tower"},
+		},
+		{
+			"too little CJK to segment", "auto", "Hello there world 日本",
+			[]string{"Hello", "there", "world", "日本"},
+		},
+		{"forced on", "cjk", "Hello 日本", []string{"Hello", "日", "本"}},
+		{"forced off", "latin", "吾輩は猫である。", []string{"吾輩は猫である。"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(mode string) { langMode = mode }(langMode)
+			langMode = tt.lang
+			if got := words(tokenize(tt.text)); !slices.Equal(got, tt.want) {
+				t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenizeLongJapaneseParagraph(t *testing.T) {
+	text := strings.Repeat("吾輩は猫である。名前はまだ無い。どこで生れたかとんと見当がつかぬ。", 50)
+	got := words(tokenize(text))
+	if n := len([]rune(text)); len(got) < n/2 {
+		t.Fatalf("%d-character paragraph gave %d units, want at least %d", n, len(got), n/2)
+	}
+	for _, w := range got {
+		if n := len([]rune(w)); n > 2 {
+			t.Fatalf("unit %q is %d characters long", w, n)
+		}
+	}
+}
+
+func TestCountPrefix(t *testing.T) {
+	tests := []struct {
+		name  string
+		start int
+		keys  []string
+		want  int
+	}{
+		{"plain jump forward", 0, []string{"]"}, 10},
+		{"plain jump back", 50, []string{"["}, 40},
+		{"count forward", 0, []string{"25]"}, 25},
+		{"count back", 50, []string{"25["}, 25},
+		{"zero inside a count", 0, []string{"10]"}, 10},
+		{"bare zero seeks to the start", 50, []string{"0"}, 0},
+		{"count resets after a motion", 0, []string{"5]", "]"}, 15},
+		{"esc drops the count", 0, []string{"5", "esc", "]"}, 10},
+		{"clamped at the start", 3, []string{"["}, 0},
+		{"count clamped at the start", 5, []string{"99["}, 0},
+		{"clamped at the end", 95, []string{"]"}, 99},
+		{"count clamped at the end", 98, []string{"3]"}, 99},
+		{"huge count", 0, []string{"99999999]"}, 99},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestModel(t, corpus(100), 100, 24)
+			m.jumpTo(tt.start)
+			m = press(m, tt.keys...)
+			if m.currentIdx != tt.want {
+				t.Errorf("after %q from %d at word %d, want %d", tt.keys, tt.start, m.currentIdx, tt.want)
+			}
+			if m.count != 0 {
+				t.Errorf("count left pending at %d", m.count)
+			}
+		})
+	}
+}
+
+func TestCountAccumulates(t *testing.T) {
+	tests := []struct {
+		typed string
+		want  int
+	}{
+		{"7", 7},
+		{"42", 42},
+		{"305", 305},
+		{"99999999", maxCount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typed, func(t *testing.T) {
+			m := press(newTestModel(t, corpus(100), 100, 24), tt.typed)
+			if m.count != tt.want {
+				t.Errorf("typing %q gave count %d, want %d", tt.typed, m.count, tt.want)
+			}
+		})
+	}
+}
+
+// marked returns the text of tokens with ¶ after each that ends a paragraph
+func marked(tokens []token) []string {
+	var out []string
+	for _, t := range tokens {
+		out = append(out, t.text)
+		if t.endsParagraph {
+			out = append(out, "¶")
+		}
+	}
+	return out
+}
+
+var paragraphTests = []struct {
+	name string
+	text string
+	want []string
+}{
+	{"empty", "", nil},
+	{"one paragraph", "one two three", []string{"one", "two", "three", "¶"}},
+	{"blank line", "one two\n\nthree", []string{"one", "two", "¶", "three", "¶"}},
+	{"single newline", "one.\ntwo", []string{"one.", "two", "¶"}},
+	{"several blank lines", "one\ntwo\n\n\n\nthree four", []string{"one", "two", "¶", "three", "four", "¶"}},
+	{"whitespace-only line", "one  \n \t\n two", []string{"one", "¶", "two", "¶"}},
+	{"leading blank lines", "  \n\none", []string{"one", "¶"}},
+	{"trailing blank lines", "one\n\n", []string{"one", "¶"}},
+	{"crlf", "one\r\n\r\ntwo", []string{"one", "¶", "two", "¶"}},
+}
+
+func TestTokenizeParagraphs(t *testing.T) {
+	for _, tt := range paragraphTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := marked(tokenize(tt.text)); !slices.Equal(got, tt.want) {
+				t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenizeParagraphsInChunks(t *testing.T) {
+	for _, tt := range paragraphTests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range len(tt.text) + 1 {
+				var tk tokenizer
+				got := tk.feed(tt.text[:i])
+				got = append(got, tk.feed(tt.text[i:])...)
+				got = append(got, tk.finish()...)
+				if got := marked(got); !slices.Equal(got, tt.want) {
+					t.Errorf("split at %d: got %q, want %q", i, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseDocumentParagraphs(t *testing.T) {
+	doc := parseDocument("one two\n\nthree\n\nfour five six")
+	if want := []int{0, 2, 3}; !slices.Equal(doc.paragraphs, want) {
+		t.Errorf("paragraphs = %v, want %v", doc.paragraphs, want)
+	}
+	if got := marked(doc.tokens()); !slices.Equal(got, marked(tokenize("one two\n\nthree\n\nfour five six"))) {
+		t.Errorf("tokens() = %q, lost paragraph ends", got)
+	}
+}
+
+func TestParseMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		readCode bool
+		raw      bool
+		want     []string
+	}{
+		{"heading", "## Title here\n\nBody", false, false, []string{"Title", "here", "Body"}},
+		{"nested emphasis", "Some **bold _nested_ text** and *it*.", false, false, []string{"Some", "bold", "nested", "text", "and", "it."}},
+		{"strikethrough", "~~gone~~ now", false, false, []string{"gone", "now"}},
+		{"escaped characters", "\\*literal\\*", false, false, []string{"*literal*"}},
+		{"inline link", "A [site](https://example.com/very/long).", false, false, []string{"A", "site."}},
+		{"reference link", "See [the docs][ref].\n\n[ref]: https://example.com", false, false, []string{"See", "the", "docs."}},
+		{"autolink", "<https://x.org> ok", false, false, []string{"https://x.org", "ok"}},
+		{"image", "![alt](img.png) Pic", false, false, []string{"Pic"}},
+		{"quote, lists and rule", "> quoted\n- one\n1. two\n---\n", false, false, []string{"quoted", "one", "two"}},
+		{"code span", "Use `go build` now", false, false, []string{"Use", "go build", "now"}},
+		{"fence with language", "```go\nfunc main() {}\nx := 1\n```\nAfter", false, false, []string{"⟨code: 2 lines⟩", "After"}},
+		{"fence kept", "```go\nx := 1\n```\nAfter", true, false, []string{"x", ":=", "1", "After"}},
+		{"unclosed fence", "Before\n```\nx := 1", false, false, []string{"Before", "⟨code: 1 line⟩"}},
+		{"indented code", "text\n\n    code\n    more\n\nafter", false, false, []string{"text", "⟨code: 2 lines⟩", "after"}},
+		{"raw", "## Title **bold** [a](b)", false, true, []string{"##", "Title", "**bold**", "[a](b)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(code, raw bool) { readCode, rawMarkdown = code, raw }(readCode, rawMarkdown)
+			readCode, rawMarkdown = tt.readCode, tt.raw
+			if got := parseMarkdown(tt.text).words; !slices.Equal(got, tt.want) {
+				t.Errorf("parseMarkdown(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMarkdownStructure(t *testing.T) {
+	doc := parseMarkdown("# Heading\nBody `code` text")
+	if want := []int{0}; !slices.Equal(doc.headings, want) {
+		t.Errorf("headings = %v, want %v", doc.headings, want)
+	}
+	if want := []int{0, 1}; !slices.Equal(doc.paragraphs, want) {
+		t.Errorf("paragraphs = %v, want %v", doc.paragraphs, want)
+	}
+	if want := []int{2}; !slices.Equal(doc.code, want) {
+		t.Errorf("code = %v, want %v", doc.code, want)
+	}
+}
+
+// writeTextFile writes about size bytes of prose in short paragraphs to a
+// temporary file, returning its path
+func writeTextFile(tb testing.TB, size int) string {
+	tb.Helper()
+	const para = "The quick brown fox jumps over the lazy dog. Pack my box with five dozen liquor jugs.\n" +
+		"How vexingly quick daft zebras jump!\n\n"
+	text := strings.Repeat(para, size/len(para)+1)
+	path := filepath.Join(tb.TempDir(), "book.txt")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+// drain reads a loader to the end, as the reader does in the background
+func drain(tb testing.TB, l *textLoader) document {
+	tb.Helper()
+	var doc document
+	for {
+		tokens, done, err := l.next()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		doc.add(tokens)
+		if done {
+			return doc
+		}
+	}
+}
+
+func TestTextLoaderMatchesTokenize(t *testing.T) {
+	// Several chunks, so words and paragraph breaks straddle their edges
+	path := writeTextFile(t, 3*loadChunkSize+1000)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := openTextFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := drain(t, l)
+	want := parseDocument(string(content))
+	if !slices.Equal(got.words, want.words) {
+		t.Errorf("loaded %d words, want %d", len(got.words), len(want.words))
+	}
+	if !slices.Equal(got.paragraphs, want.paragraphs) {
+		t.Errorf("loaded %d paragraphs, want %d", len(got.paragraphs), len(want.paragraphs))
+	}
+}
+
+// loadAll runs the commands that load a document chunk by chunk, passing
+// the chunks to the model until the last has arrived
+func loadAll(m model, cmd tea.Cmd) model {
+	for cmd != nil {
+		msgs := []tea.Msg{cmd()}
+		if batch, ok := msgs[0].(tea.BatchMsg); ok {
+			msgs = msgs[:0]
+			for _, c := range batch {
+				if c != nil {
+					msgs = append(msgs, c())
+				}
+			}
+		}
+		cmd = nil
+		for _, msg := range msgs {
+			if msg, ok := msg.(chunkMsg); ok {
+				var updated tea.Model
+				updated, cmd = m.Update(msg)
+				m = updated.(model)
+			}
+		}
+	}
+	return m
+}
+
+func TestStreamingLoadCountsUntilDone(t *testing.T) {
+	path := writeTextFile(t, 3*loadChunkSize)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := len(tokenize(string(content)))
+
+	m := newTestModel(t, []string{"placeholder"}, 100, 24)
+	l, err := openTextFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := m.startLoading(l, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.words) == 0 || len(m.words) >= want {
+		t.Fatalf("first chunk held %d of %d words", len(m.words), want)
+	}
+	if view := ansi.Strip(m.View()); !strings.Contains(view, "counting…") {
+		t.Errorf("view while loading doesn't say it's counting:\n%s", view)
+	}
+
+	m = loadAll(m, cmd)
+	if len(m.words) != want {
+		t.Errorf("loaded %d words, want %d", len(m.words), want)
+	}
+	if view := ansi.Strip(m.View()); strings.Contains(view, "counting…") || !strings.Contains(view, formatCount(want)) {
+		t.Errorf("view once loaded doesn't give the total of %d:\n%s", want, view)
+	}
+}
+
+// Size of the file the loading benchmarks read
+const benchFileSize = 8 << 20
+
+// BenchmarkLoad compares reading a whole file before tokenizing it with
+// streaming it through a textLoader
+func BenchmarkLoad(b *testing.B) {
+	path := writeTextFile(b, benchFileSize)
+	b.Run("whole", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			parseDocument(string(content))
+		}
+	})
+	b.Run("streaming", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			l, err := openTextFile(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			drain(b, l)
+		}
+	})
+}
+
+// BenchmarkFirstWord compares how soon the first word can be shown when a
+// whole file is read first and when it's streamed
+func BenchmarkFirstWord(b *testing.B) {
+	path := writeTextFile(b, benchFileSize)
+	b.Run("whole", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_ = parseDocument(string(content)).words[0]
+		}
+	})
+	b.Run("streaming", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			l, err := openTextFile(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			tokens, _, err := l.next()
+			if err != nil {
+				b.Fatal(err)
+			}
+			_ = tokens[0]
+			l.close()
+		}
+	})
+}
+
+// compressed encodes data with a Content-Encoding
+func compressed(tb testing.TB, encoding string, data []byte) []byte {
+	tb.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	default:
+		return data
+	}
+	if _, err := w.Write(data); err != nil {
+		tb.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// compressingServer serves body with the Content-Encoding named by the
+// request's enc query parameter, failing requests that didn't offer it
+func compressingServer(tb testing.TB, body []byte) *httptest.Server {
+	tb.Helper()
+	bodies := make(map[string][]byte)
+	for _, enc := range []string{"", "gzip", "deflate", "br"} {
+		bodies[enc] = compressed(tb, enc, body)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := r.URL.Query().Get("enc")
+		if enc != "" && !strings.Contains(r.Header.Get("Accept-Encoding"), enc) {
+			http.Error(w, "encoding not accepted", http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if enc != "" {
+			w.Header().Set("Content-Encoding", enc)
+		}
+		w.Write(bodies[enc])
+	}))
+	tb.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDownloadDecompresses(t *testing.T) {
+	const page = "<html><head><title>Packed</title></head><body><p>Squeezed words survive the trip.</p></body></html>"
+	srv := compressingServer(t, []byte(page))
+	for _, enc := range []string{"", "gzip", "deflate", "br"} {
+		t.Run(cmp.Or(enc, "identity"), func(t *testing.T) {
+			got, err := download(context.Background(), srv.URL+"/?enc="+enc, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Content != page {
+				t.Errorf("content = %q, want %q", got.Content, page)
+			}
+			if want := []string{"Squeezed", "words", "survive", "the", "trip."}; !slices.Equal(parseMarkdown(got.Text).words, want) {
+				t.Errorf("words = %q, want %q", parseMarkdown(got.Text).words, want)
+			}
+		})
+	}
+}
+
+func TestDownloadLimitsDecompressedSize(t *testing.T) {
+	defer func(size int64) { maxFetchSize = size }(maxFetchSize)
+	maxFetchSize = 1 << 10
+	// Compresses to far less than the limit
+	srv := compressingServer(t, bytes.Repeat([]byte("a"), 1<<20))
+	for _, enc := range []string{"gzip", "br"} {
+		t.Run(enc, func(t *testing.T) {
+			_, err := download(context.Background(), srv.URL+"/?enc="+enc, nil)
+			if err == nil || !strings.Contains(err.Error(), "too large") {
+				t.Errorf("err = %v, want content too large", err)
+			}
+		})
+	}
+}
+
+// checkFits fails if the view has more lines or wider lines than the terminal
+func checkFits(t *testing.T, m model) {
+	t.Helper()
+	lines := viewLines(m)
+	if len(lines) > m.height {
+		t.Errorf("%d lines on a %d-line terminal", len(lines), m.height)
+	}
+	for i, line := range lines {
+		if w := uniseg.StringWidth(line); w > m.width {
+			t.Errorf("line %d is %d cells on a %d-cell terminal: %q", i, w, m.width, line)
+		}
+	}
+}
+
+func TestViewBelowMinimumSize(t *testing.T) {
+	tests := []struct {
+		width, height int
+		tooSmall      bool
+	}{
+		{minWidth - 1, 30, true},
+		{100, minHeight - 1, true},
+		{10, 5, true},
+		{1, 1, true},
+		{minWidth, minHeight, false},
+		{120, 40, false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%dx%d", tt.width, tt.height), func(t *testing.T) {
+			m := newTestModel(t, corpus(50), tt.width, tt.height)
+			m.play()
+			updated, _ := m.Update(tea.WindowSizeMsg{Width: tt.width, Height: tt.height})
+			m = updated.(model)
+			view := m.View()
+			if got := view == m.tooSmallView(); got != tt.tooSmall {
+				t.Errorf("too small message shown = %v, want %v:\n%s", got, tt.tooSmall, ansi.Strip(view))
+			}
+			if tt.width >= len("Terminal too small") && tt.tooSmall && !strings.Contains(ansi.Strip(view), "Terminal too small") {
+				t.Errorf("message missing:\n%s", ansi.Strip(view))
+			}
+			if tt.tooSmall && !m.paused {
+				t.Error("still playing on a terminal too small to read")
+			}
+			checkFits(t, m)
+		})
+	}
+}
+
+func TestWebTextStripsReferences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"after a full stop", "word.[4] next", "word. next"},
+		{"glued to a word", "word[3] next", "word next"},
+		{"standalone", "end [12] of", "end of"},
+		{"after a comma", "first,[2] second", "first, second"},
+		{"several in a row", "word.[4][5] next", "word. next"},
+		{"lists and ranges", "seen [3, 4] and [5–7].", "seen and."},
+		{"after a year", "in 2019 [1]", "in 2019"},
+		{"words in brackets", "[citation needed]", "[citation needed]"},
+		{"index expression", "array[i] here", "array[i] here"},
+		{"long url", "see https://example.com/a/very/long/path/to/page.html.", "see ⟨link⟩."},
+		{"long url in parentheses", "(https://example.com/a/very/long/path/to/x)", "(⟨link⟩)"},
+		{"long www url", "www.example.com/some/really/long/path/here", "⟨link⟩"},
+		{"short url", "short https://x.org ok", "short https://x.org ok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := webText(tt.text); got != tt.want {
+				t.Errorf("webText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebTextKeepRefs(t *testing.T) {
+	defer func(keep bool) { keepRefs = keep }(keepRefs)
+	keepRefs = true
+	const text = "word.[4] see https://example.com/a/very/long/path/to/page.html"
+	if got := webText(text); got != text {
+		t.Errorf("webText(%q) with -keep-refs = %q", text, got)
+	}
+}
+
+func TestParseMarkdownStripsCitations(t *testing.T) {
+	got := parseMarkdown("A claim.[4] Another[3] one.").words
+	if want := []string{"A", "claim.", "Another", "one."}; !slices.Equal(got, want) {
+		t.Errorf("words = %q, want %q", got, want)
+	}
+}
+
+func TestTimeRemainingMatchesPlayback(t *testing.T) {
+	const text = "# A heading\n\nShort words, then a rather extraordinarily incomprehensible one. " +
+		"Does it pause? It does!\n\nA second paragraph follows; it ends here.\n\n" +
+		"Pneumonoultramicroscopicsilicovolcanoconiosis is long enough for frames."
+	tests := []struct {
+		name     string
+		wpm      int
+		adaptive bool
+		ease     bool
+		warmup   bool
+		ramp     *speedRamp
+	}{
+		{"plain", 300, false, false, false, nil},
+		{"fast", 900, false, false, false, nil},
+		{"adaptive", 300, true, false, false, nil},
+		{"eased sentences", 300, false, true, false, nil},
+		{"adaptive and eased", 450, true, true, false, nil},
+		{"warm-up", 400, false, false, true, nil},
+		{"ramp", 600, false, false, false, &speedRamp{from: 200, to: 600, over: 5 * time.Second}},
+		{"adaptive ramp", 600, true, true, false, &speedRamp{from: 300, to: 600, over: 3 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := initialModel(parseMarkdown(text), tt.wpm)
+			updated, _ := m.Update(tea.WindowSizeMsg{Width: 100, Height: 24})
+			m = updated.(model)
+			m.easeSentences = tt.ease
+			m.warmup = tt.warmup
+			m.ramp = tt.ramp
+			m.setAdaptive(tt.adaptive)
+
+			for start := range len(m.words) - 1 {
+				m.jumpTo(start)
+				m.playElapsed = 0
+				estimate := m.timeRemaining()
+
+				// Play on from start, adding up how long each frame of the
+				// words after it stays on screen. The playing time is moved
+				// on by each frame's delay, as if it had been waited out.
+				m.paused = false
+				var played time.Duration
+				for {
+					d := m.wordDelay(m.currentIdx)
+					if m.currentIdx > start {
+						played += d
+					}
+					if m.currentIdx == len(m.words)-1 && m.frame == len(m.frames())-1 {
+						break
+					}
+					m.playElapsed += d
+					updated, _ := m.Update(tickMsg(time.Now()))
+					m = updated.(model)
+				}
+				m.paused = true
+
+				// Each frame's delay is rounded to the nanosecond
+				if diff := (estimate - played).Abs(); diff > time.Duration(len(m.words)) {
+					t.Errorf("from word %d: estimate %v, playback %v", start, estimate, played)
+				}
+			}
+		})
+	}
+}
+
+func TestViewFollowsResizes(t *testing.T) {
+	words := strings.Fields("a fairly ordinary sentence with some extraordinarily long words in the middle of it")
+	m := newTestModel(t, words, 120, 40)
+	m.jumpTo(6)
+	orp := graphemes(words[6])[calculateORP(words[6])]
+	sizes := []struct{ width, height int }{
+		{120, 40}, {60, 20}, {minWidth, minHeight}, {30, 10}, {200, 50}, {45, 30}, {80, 13}, {80, 24},
+	}
+	for _, size := range sizes {
+		updated, _ := m.Update(tea.WindowSizeMsg{Width: size.width, Height: size.height})
+		m = updated.(model)
+		t.Run(fmt.Sprintf("%dx%d", size.width, size.height), func(t *testing.T) {
+			checkFits(t, m)
+			if m.tooSmall() {
+				return
+			}
+			lines := viewLines(m)
+			row := m.wordRow()
+			if got := cellAt(lines[row], m.focusCol); got != orp {
+				t.Errorf("column %d of the word row %q is %q, want the ORP", m.focusCol, lines[row], got)
+			}
+			if got := cellAt(lines[row-1], m.focusCol); got != m.guideChar {
+				t.Errorf("column %d of the guide row %q is %q, want %q", m.focusCol, lines[row-1], got, m.guideChar)
+			}
+			if off := m.focusCol - size.width/2; off < -1 || off > 1 {
+				t.Errorf("focus column %d isn't centred in %d columns", m.focusCol, size.width)
+			}
+		})
+	}
+}
+
+func BenchmarkViewContext(b *testing.B) {
+	for _, n := range []int{1_000, 500_000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			m := newTestModel(b, corpus(n), 120, 30)
+			m.jumpTo(n - 1)
+			b.ResetTimer()
+			for b.Loop() {
+				m.View()
+			}
+		})
+	}
+}
+
+func TestNewSession(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		opts    Options
+		want    []string
+		wantErr bool
+	}{
+		{"plain text", "one two\n\nthree", Options{}, []string{"one", "two", "three"}, false},
+		{"markdown", "# Title\n\nSome **bold** text", Options{Markdown: true}, []string{"Title", "Some", "bold", "text"}, false},
+		{"binary", "bin\x00ary", Options{}, nil, true},
+		{"empty", "", Options{}, nil, true},
+		{"unknown theme", "words", Options{Theme: "plaid"}, nil, true},
+		{"unknown lang", "words", Options{Lang: "klingon"}, nil, true},
+		{"wide guide", "words", Options{GuideChar: "界"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSession(strings.NewReader(tt.text), tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSession err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			m := s.Model().(model)
+			if got := m.words; !slices.Equal(got, tt.want) {
+				t.Errorf("words = %q, want %q", got, tt.want)
+			}
+			if m.wpm != defaultConfig().WPM {
+				t.Errorf("wpm = %d, want the default %d", m.wpm, defaultConfig().WPM)
+			}
+		})
+	}
+}
+
+func TestRunQuits(t *testing.T) {
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(strings.NewReader("a few words to read"), Options{
+			WPM:    250,
+			Input:  strings.NewReader("q"),
+			Output: io.Discard,
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return after q")
+	}
+}
+
+func TestSessionKeepsStateOnlyWhenAsked(t *testing.T) {
+	for _, state := range []bool{false, true} {
+		t.Run(fmt.Sprintf("State %v", state), func(t *testing.T) {
+			t.Setenv("XDG_STATE_HOME", t.TempDir())
+			s, err := NewSession(strings.NewReader("some words to mark"), Options{State: state})
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := press(s.Model().(model), "m", "a")
+			if _, saved := loadDocState(m.docHash).Marks["a"]; saved != state {
+				t.Errorf("mark saved = %v, want %v", saved, state)
+			}
+		})
+	}
+}
+
+func TestFetchURLCachesOnlyWhenAsked(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "fetched text")
+	}))
+	defer srv.Close()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	tests := []struct {
+		name   string
+		fetch  func(context.Context, string) ([]byte, string, error)
+		cached bool
+	}{
+		{"FetchURL", FetchURL, false},
+		{"FetchCachedURL", FetchCachedURL, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url := srv.URL + "/" + tt.name
+			body, media, err := tt.fetch(context.Background(), url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != "fetched text" || media != "text/plain" {
+				t.Errorf("got %q as %q", body, media)
+			}
+			if _, ok := loadCachedPage(url); ok != tt.cached {
+				t.Errorf("page cached = %v, want %v", ok, tt.cached)
+			}
+		})
+	}
+}
+
+// oscSequence matches an operating system command, such as setting the title
+var oscSequence = regexp.MustCompile("\x1b][^\a\x1b]*(\a|\x1b\\\\)")
+
+func TestRunRingsBellOnOutput(t *testing.T) {
+	var out bytes.Buffer
+	err := Run(strings.NewReader("two words"), Options{
+		WPM:      1000,
+		OnFinish: "quit",
+		Bell:     true,
+		Input:    strings.NewReader(" "),
+		Output:   &out,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Window titles are set with sequences that end in a bell too
+	if rest := oscSequence.ReplaceAllString(out.String(), ""); !strings.Contains(rest, "\a") {
+		t.Errorf("no bell in the output %q", out.String())
+	}
+}
+
+func TestResumeRewind(t *testing.T) {
+	tests := []struct {
+		name          string
+		rewind        int
+		from          int
+		wantIdx       int
+		wantCountdown bool
+	}{
+		{"none", 0, 5, 5, false},
+		{"a few words", 3, 5, 2, true},
+		{"clamped at the start", 10, 5, 0, true},
+		{"from the first word", 3, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestModel(t, corpus(20), 100, 30)
+			m.rewindOnResume = tt.rewind
+			m.jumpTo(tt.from)
+			m = press(m, " ")
+			if m.currentIdx != tt.wantIdx {
+				t.Errorf("resumed at word %d, want %d", m.currentIdx, tt.wantIdx)
+			}
+			if counting := m.countdown > 0; counting != tt.wantCountdown {
+				t.Errorf("counting down = %v, want %v", counting, tt.wantCountdown)
+			}
+			if playing := !m.paused; playing == tt.wantCountdown {
+				t.Errorf("playing = %v, want %v", playing, !tt.wantCountdown)
+			}
+		})
+	}
+}
+
+func TestVimDoubleG(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides map[string]keyList
+		double    bool
+	}{
+		{"preset", nil, true},
+		{"start moved off g", map[string]keyList{"start": {"home"}}, false},
+		{"ghost back on g", map[string]keyList{"ghost": {"g"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved, savedFp, savedPicker := keys, fpKeys, pickerKeys
+			t.Cleanup(func() {
+				keys, fpKeys, pickerKeys = saved, savedFp, savedPicker
+				clear(doubleKeys)
+			})
+			remapKeys(applyKeyPreset("vim", tt.overrides))
+			setDoubleKeys("vim")
+			if doubleKeys["g"] != tt.double {
+				t.Fatalf("g is a double key = %v, want %v", doubleKeys["g"], tt.double)
+			}
+
+			m := newTestModel(t, corpus(20), 100, 30)
+			m.jumpTo(10)
+			m = press(m, "g")
+			if waiting := m.pendingKey == "g"; waiting != tt.double {
+				t.Errorf("waiting for a second g = %v, want %v", waiting, tt.double)
+			}
+			if tt.double {
+				if m = press(m, "g"); m.currentIdx != 0 {
+					t.Errorf("gg went to word %d, want the start", m.currentIdx)
+				}
+			}
+		})
+	}
+}